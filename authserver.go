@@ -0,0 +1,94 @@
+package ynote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"time"
+)
+
+/*
+	AuthorizeLocally authorizes the client without asking the end-user to copy
+	the verifier. It starts an HTTP server on a random port of the loopback
+	interface and requests temporary credentials with it as the callback. Then
+	openURL is called with the authorization URL, e.g. to open it in a browser.
+	After the end-user authorizes the request, the browser is redirected to the
+	server, which captures the verifier, and the access token is requested with
+	it.
+
+	Callbacks with an oauth_token different from the temporary credentials are
+	rejected. An error is returned if the flow does not finish in timeout, or
+	ctx is done. As RequestToken, the AccToken field is set and saved to the
+	token store, if any, if succeed.
+*/
+func (yc *YnoteClient) AuthorizeLocally(ctx context.Context, timeout time.Duration,
+	openURL func(authURL string) error) (*Credentials, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	callback := "http://" + ln.Addr().String() + "/callback"
+
+	tmpCred, err := yc.RequestTemporaryCredentialsWithCallBackContext(ctx, callback)
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	verifiers := make(chan string, 1)
+	srv := &http.Server{
+		Handler: callbackHandler(tmpCred.Token, verifiers),
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	if err := openURL(yc.AuthorizationURL(tmpCred)); err != nil {
+		return nil, err
+	}
+
+	select {
+	case verifier := <-verifiers:
+		return yc.RequestTokenContext(ctx, tmpCred, verifier)
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("ynote: authorization not finished in %v", timeout)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+/*
+	callbackHandler returns the handler of the OAuth callback, which sends the
+	verifier of a request with the expected token to verifiers.
+*/
+func callbackHandler(token string, verifiers chan<- string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("oauth_token") != token {
+			http.Error(w, "The oauth_token does not match the request.", http.StatusBadRequest)
+			return
+		}
+		verifier := q.Get("oauth_verifier")
+		if verifier == "" {
+			http.Error(w, "No oauth_verifier, the request was not authorized.", http.StatusBadRequest)
+			return
+		}
+
+		select {
+		case verifiers <- verifier:
+		default:
+			// Already got one.
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, "<html><body><p>%s</p></body></html>",
+			html.EscapeString("Authorized. You may close this window now."))
+	})
+	return mux
+}
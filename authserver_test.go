@@ -0,0 +1,106 @@
+package ynote_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	ynote "github.com/youdao-api/go-ynote"
+	"github.com/youdao-api/go-ynote/ynotetest"
+)
+
+/* noRedirects is a client returning redirects instead of following them. */
+var noRedirects = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func TestAuthorizeLocally(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	yc := ynote.NewYnoteClient(ynotetest.Consumer, srv.URL)
+
+	token, err := yc.AuthorizeLocally(context.Background(), 10*time.Second, func(authURL string) error {
+		// The browser follows the redirect to the callback.
+		res, err := http.Get(authURL)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("callback: %s", res.Status)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if yc.AccToken == nil || *yc.AccToken != *token {
+		t.Errorf("AccToken = %v, want %v", yc.AccToken, token)
+	}
+	if ui, err := yc.UserInfo(); err != nil || ui.User != ynotetest.User {
+		t.Errorf("UserInfo: %v, %v", ui, err)
+	}
+}
+
+func TestAuthorizeLocallyWrongToken(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	yc := ynote.NewYnoteClient(ynotetest.Consumer, srv.URL)
+
+	_, err := yc.AuthorizeLocally(context.Background(), 10*time.Second, func(authURL string) error {
+		res, err := noRedirects.Get(authURL)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		callback, err := url.Parse(res.Header.Get("Location"))
+		if err != nil {
+			return err
+		}
+
+		// A callback of another request is rejected.
+		forged := *callback
+		q := forged.Query()
+		q.Set("oauth_token", "forged")
+		forged.RawQuery = q.Encode()
+		res, err = http.Get(forged.String())
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("forged callback: %s, want 400", res.Status)
+		}
+
+		res, err = http.Get(callback.String())
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuthorizeLocallyTimeout(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	yc := ynote.NewYnoteClient(ynotetest.Consumer, srv.URL)
+
+	_, err := yc.AuthorizeLocally(context.Background(), 50*time.Millisecond, func(string) error {
+		// The end-user never authorizes.
+		return nil
+	})
+	if err == nil {
+		t.Fatal("AuthorizeLocally succeeded")
+	}
+	if yc.AccToken != nil {
+		t.Errorf("AccToken = %v, want nil", yc.AccToken)
+	}
+}
@@ -0,0 +1,196 @@
+package backup
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+/* Format is the format of an archive. */
+type Format int
+
+const (
+	// A gzipped tar file
+	TarGz Format = iota
+	// A zip file
+	Zip
+)
+
+/*
+	FormatOf returns the format of an archive by the extension of filename:
+	Zip for .zip, TarGz otherwise.
+*/
+func FormatOf(filename string) Format {
+	if strings.HasSuffix(strings.ToLower(filename), ".zip") {
+		return Zip
+	}
+	return TarGz
+}
+
+/* archiveWriter writes the entries of an archive in order. */
+type archiveWriter interface {
+	// create starts an entry of size bytes.
+	create(name string, size int64, modTime time.Time) (io.Writer, error)
+	close() error
+}
+
+func newArchiveWriter(w io.Writer, format Format) archiveWriter {
+	if format == Zip {
+		return &zipWriter{zip.NewWriter(w)}
+	}
+	gz := gzip.NewWriter(w)
+	return &tarWriter{gz: gz, tw: tar.NewWriter(gz)}
+}
+
+type tarWriter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func (w *tarWriter) create(name string, size int64, modTime time.Time) (io.Writer, error) {
+	err := w.tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  modTime,
+		Typeflag: tar.TypeReg,
+	})
+	return w.tw, err
+}
+
+func (w *tarWriter) close() error {
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	return w.gz.Close()
+}
+
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func (w *zipWriter) create(name string, size int64, modTime time.Time) (io.Writer, error) {
+	return w.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modTime,
+	})
+}
+
+func (w *zipWriter) close() error {
+	return w.zw.Close()
+}
+
+/* archiveReader reads the entries of an archive in order. */
+type archiveReader interface {
+	// next returns the next entry, or io.EOF at the end.
+	next() (name string, size int64, r io.Reader, err error)
+	close() error
+}
+
+/* The magic numbers of the formats */
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zipMagic  = []byte("PK\x03\x04")
+)
+
+/*
+	openArchive opens an archive file, detecting the format by its content.
+*/
+func openArchive(filename string) (archiveReader, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	magic := make([]byte, 4)
+	n, _ := io.ReadFull(f, magic)
+	magic = magic[:n]
+	switch {
+	case bytes.HasPrefix(magic, zipMagic):
+		f.Close()
+		zr, err := zip.OpenReader(filename)
+		if err != nil {
+			return nil, err
+		}
+		return &zipReader{zr: zr}, nil
+	case bytes.HasPrefix(magic, gzipMagic):
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &tarReader{f: f, tr: tar.NewReader(gz)}, nil
+	}
+
+	f.Close()
+	return nil, ErrNotArchive
+}
+
+/* ErrNotArchive is returned for a file neither a tar.gz nor a zip file. */
+var ErrNotArchive = errors.New("backup: not a tar.gz or zip archive")
+
+type tarReader struct {
+	f  *os.File
+	tr *tar.Reader
+}
+
+func (r *tarReader) next() (string, int64, io.Reader, error) {
+	for {
+		hdr, err := r.tr.Next()
+		if err != nil {
+			return "", 0, nil, err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			return hdr.Name, hdr.Size, r.tr, nil
+		}
+	}
+}
+
+func (r *tarReader) close() error {
+	return r.f.Close()
+}
+
+type zipReader struct {
+	zr  *zip.ReadCloser
+	i   int
+	cur io.ReadCloser
+}
+
+func (r *zipReader) next() (string, int64, io.Reader, error) {
+	if r.cur != nil {
+		r.cur.Close()
+		r.cur = nil
+	}
+	for ; r.i < len(r.zr.File); r.i++ {
+		f := r.zr.File[r.i]
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return "", 0, nil, err
+		}
+		r.i++
+		r.cur = rc
+		return f.Name, int64(f.UncompressedSize64), rc, nil
+	}
+	return "", 0, nil, io.EOF
+}
+
+func (r *zipReader) close() error {
+	if r.cur != nil {
+		r.cur.Close()
+	}
+	return r.zr.Close()
+}
@@ -0,0 +1,460 @@
+/*
+	Package backup backs up all notebooks, notes and their resources of an
+	account to an archive, and restores them.
+
+		f, err := os.Create("backup.tar.gz")
+		...
+		m, err := backup.Backup(ctx, yc, f, backup.TarGz)
+		...
+		err = f.Close()
+
+	and later, into the same or another account:
+
+		restored, err := backup.Restore(ctx, yc, "backup.tar.gz")
+
+	An archive is a tar.gz or zip file containing:
+
+		manifest.json                   the Manifest
+		resources/<sha256><ext>         the resources, i.e. images and
+		                                attachments, stored by the service
+		notes/<notebook>/<note>.html    the contents of the notes
+
+	The manifest is the first entry, and the resources precede the notes, so
+	an archive is restored in a single pass. The SHA-256 of every note and
+	resource is recorded in the manifest and checked by Restore and Verify.
+
+	BackupIncremental writes an archive of the changes since a previous one,
+	referring to the entries of the previous archives for the rest. Such a
+	chain of archives is kept in a directory, and any of them restores the
+	account as of its backup.
+*/
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	ynote "github.com/youdao-api/go-ynote"
+	"github.com/youdao-api/go-ynote/notecontent"
+)
+
+/*
+	The version of the archive format written by Backup. Version 1 archives
+	do not refer to other archives.
+*/
+const FormatVersion = 2
+
+/* The name of the manifest in an archive */
+const ManifestName = "manifest.json"
+
+/* Manifest describes the content of an archive. */
+type Manifest struct {
+	// FormatVersion of the archive
+	Version int `json:"version"`
+	// The time the backup started
+	Created time.Time `json:"created"`
+	// The user backed up
+	User string `json:"user"`
+	// The file name of the archive an incremental backup is based on
+	Base string `json:"base,omitempty"`
+
+	Notebooks []*Notebook `json:"notebooks"`
+	Resources []*Resource `json:"resources"`
+}
+
+/* Notebook is a notebook in a Manifest. */
+type Notebook struct {
+	Path       string    `json:"path"`
+	Name       string    `json:"name"`
+	Group      string    `json:"group,omitempty"`
+	CreateTime time.Time `json:"create_time"`
+	ModifyTime time.Time `json:"modify_time"`
+	NotesNum   int       `json:"notes_num"`
+
+	Notes []*Note `json:"notes"`
+}
+
+/* Note is a note in a Manifest. */
+type Note struct {
+	Path       string    `json:"path"`
+	Title      string    `json:"title"`
+	Author     string    `json:"author,omitempty"`
+	Source     string    `json:"source,omitempty"`
+	CreateTime time.Time `json:"create_time"`
+	ModifyTime time.Time `json:"modify_time"`
+	Size       int64     `json:"size"`
+
+	// The entry of the content in the archive
+	File string `json:"file"`
+	// The file name of the archive containing File, in the directory of
+	// this one, if not this one
+	Archive string `json:"archive,omitempty"`
+	SHA256  string `json:"sha256"`
+	// The URLs of the resources referenced by the content
+	Resources []string `json:"resources,omitempty"`
+}
+
+/* Resource is an image or attachment stored by the service. */
+type Resource struct {
+	URL string `json:"url"`
+	// The file name, i.e. the last element of the URL
+	Name string `json:"name"`
+	// The URL of the icon shown for an attachment, empty for an image
+	Icon string `json:"icon,omitempty"`
+
+	// The entry in the archive, shared by resources of the same content.
+	// Empty if Missing.
+	File string `json:"file,omitempty"`
+	// The file name of the archive containing File, if not this one
+	Archive string `json:"archive,omitempty"`
+	Size    int64  `json:"size"`
+	SHA256  string `json:"sha256,omitempty"`
+	// The resource was not found when backing up.
+	Missing bool `json:"missing,omitempty"`
+}
+
+/*
+	Backup writes an archive of all notebooks, notes and resources of the
+	user of s to w. The resources are downloaded into temporary files first.
+
+	Resources referenced by notes but not found are recorded as Missing
+	rather than failing the backup.
+*/
+func Backup(ctx context.Context, s ynote.NoteService, w io.Writer, format Format) (*Manifest, error) {
+	b := &backuper{ctx: ctx, s: s, contents: make(map[string][]byte)}
+	defer b.cleanup()
+
+	if err := b.collect(); err != nil {
+		return nil, err
+	}
+	if err := b.downloadResources(); err != nil {
+		return nil, err
+	}
+	if err := b.write(w, format); err != nil {
+		return nil, err
+	}
+	return b.m, nil
+}
+
+type backuper struct {
+	ctx context.Context
+	s   ynote.NoteService
+	m   *Manifest
+	// The archive of an incremental backup is based on, nil for a full one
+	base *baseArchive
+
+	// The contents of the notes by their entries
+	contents map[string][]byte
+	// The downloaded resources by their entries
+	tmpFiles map[string]string
+}
+
+/* collect lists the notebooks and fetches all notes. */
+func (b *backuper) collect() error {
+	ui, err := b.s.UserInfoContext(b.ctx)
+	if err != nil {
+		return err
+	}
+	b.m = &Manifest{Version: FormatVersion, Created: time.Now(), User: ui.User}
+	if b.base != nil {
+		b.m.Base = b.base.name
+	}
+
+	nbs, err := b.s.ListNotebooksContext(b.ctx)
+	if err != nil {
+		return err
+	}
+	urls := make(map[string]bool)
+	addResources := func(n *Note, icons map[string]string) {
+		for _, u := range n.Resources {
+			if !urls[u] {
+				urls[u] = true
+				b.m.Resources = append(b.m.Resources, b.resource(u, icons[u]))
+			}
+		}
+	}
+	for _, nbi := range nbs {
+		nb := &Notebook{
+			Path:       nbi.Path,
+			Name:       nbi.Name,
+			Group:      nbi.Group,
+			CreateTime: nbi.CreateTime,
+			ModifyTime: nbi.ModifyTime,
+			NotesNum:   nbi.NotesNum,
+		}
+		b.m.Notebooks = append(b.m.Notebooks, nb)
+
+		if notes := b.base.unchangedNotes(nbi); notes != nil {
+			nb.Notes = notes
+			for _, n := range notes {
+				addResources(n, nil)
+			}
+			continue
+		}
+
+		paths, err := b.s.ListNotesContext(b.ctx, nbi.Path)
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			ni, err := b.s.NoteInfoContext(b.ctx, p)
+			if err != nil {
+				return err
+			}
+			n, icons := newNote(p, ni)
+			if !b.base.reuseNote(n) {
+				b.contents[n.File] = []byte(ni.Content)
+			}
+			addResources(n, icons)
+			nb.Notes = append(nb.Notes, n)
+		}
+	}
+	return nil
+}
+
+/*
+	resource returns the Resource of a URL, the one of the base archive if it
+	is there.
+*/
+func (b *backuper) resource(u, icon string) *Resource {
+	if r := b.base.resource(u); r != nil {
+		return r
+	}
+	return &Resource{URL: u, Name: resourceName(u), Icon: icon}
+}
+
+/*
+	newNote returns the Note of ni, and the icons of the attachments it refers
+	to by URL.
+*/
+func newNote(p string, ni *ynote.NoteInfo) (*Note, map[string]string) {
+	urls, icons := resourceURLs(ni.Content)
+	return &Note{
+		Path:       p,
+		Title:      ni.Title,
+		Author:     ni.Author,
+		Source:     ni.Source,
+		CreateTime: ni.CreateTime,
+		ModifyTime: ni.ModifyTime,
+		Size:       ni.Size,
+		File:       noteEntry(p),
+		SHA256:     sha256Hex([]byte(ni.Content)),
+		Resources:  urls,
+	}, icons
+}
+
+/*
+	noteEntry returns the entry of the content of a note in an archive.
+	Characters other than letters, digits and /._- are replaced with _, and
+	then a hash of the path is appended after a ~, which is never kept, so
+	different notes, e.g. /nb/a b and /nb/a_b, get different entries.
+*/
+func noteEntry(notePath string) string {
+	p := strings.TrimPrefix(notePath, "/")
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+			strings.ContainsRune("/._-", r) {
+			return r
+		}
+		return '_'
+	}, p)
+	if name != p {
+		name += "~" + sha256Hex([]byte(notePath))[:16]
+	}
+	return "notes/" + name + ".html"
+}
+
+/*
+	resourceURLs returns the URLs of the stored resources a content refers to,
+	and the icons of the attachments by URL.
+*/
+func resourceURLs(content string) ([]string, map[string]string) {
+	doc := notecontent.Parse(content)
+	var urls []string
+	seen := make(map[string]bool)
+	add := func(u string) {
+		// Only resources stored by the service, not e.g. images linked from
+		// other sites, which would get the access token in the signature.
+		if strings.Contains(u, "/yws/") && !seen[u] {
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+	for _, img := range doc.Images() {
+		add(img.Src)
+	}
+	icons := make(map[string]string)
+	for _, a := range doc.Attachments() {
+		add(a.URL)
+		icons[a.URL] = a.Icon
+	}
+	return urls, icons
+}
+
+func resourceName(u string) string {
+	return path.Base(strings.SplitN(u, "?", 2)[0])
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+/*
+	downloadResources downloads the resources into temporary files. Resources
+	of the same content share the entry.
+*/
+func (b *backuper) downloadResources() error {
+	b.tmpFiles = make(map[string]string)
+	for _, r := range b.m.Resources {
+		if r.Archive != "" {
+			// Unchanged since the base archive
+			continue
+		}
+		tmp, err := ioutil.TempFile("", "ynote-backup-")
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		n, err := b.s.DownloadAttachment(b.ctx, r.URL, io.MultiWriter(tmp, h))
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if errors.Is(err, ynote.ErrNotFound) {
+			os.Remove(tmp.Name())
+			r.Missing = true
+			continue
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+			return fmt.Errorf("backup: download %s: %w", r.URL, err)
+		}
+
+		r.Size, r.SHA256 = n, hex.EncodeToString(h.Sum(nil))
+		r.File = "resources/" + r.SHA256 + path.Ext(r.Name)
+		if br := b.base.resourceOf(r.SHA256); br != nil {
+			// The same content is in the base archives.
+			r.File, r.Archive = br.File, br.Archive
+			os.Remove(tmp.Name())
+		} else if _, ok := b.tmpFiles[r.File]; ok {
+			os.Remove(tmp.Name())
+		} else {
+			b.tmpFiles[r.File] = tmp.Name()
+		}
+	}
+	return nil
+}
+
+func (b *backuper) cleanup() {
+	for _, fn := range b.tmpFiles {
+		os.Remove(fn)
+	}
+}
+
+/* write writes the manifest, resources and notes to an archive. */
+func (b *backuper) write(w io.Writer, format Format) error {
+	aw := newArchiveWriter(w, format)
+
+	js, err := json.MarshalIndent(b.m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeEntry(aw, ManifestName, js, b.m.Created); err != nil {
+		return err
+	}
+
+	for _, name := range sortedKeys(b.tmpFiles) {
+		if err := copyEntry(aw, name, b.tmpFiles[name], b.m.Created); err != nil {
+			return err
+		}
+	}
+
+	for _, nb := range b.m.Notebooks {
+		for _, n := range nb.Notes {
+			if n.Archive != "" {
+				continue
+			}
+			if err := writeEntry(aw, n.File, b.contents[n.File], n.ModifyTime); err != nil {
+				return err
+			}
+		}
+	}
+
+	return aw.close()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeEntry(aw archiveWriter, name string, data []byte, modTime time.Time) error {
+	w, err := aw.create(name, int64(len(data)), modTime)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func copyEntry(aw archiveWriter, name, fn string, modTime time.Time) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	w, err := aw.create(name, fi.Size(), modTime)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+/* ErrChecksum is returned if an entry of an archive is corrupted. */
+var ErrChecksum = errors.New("backup: checksum mismatch")
+
+/* checkingReader computes the SHA-256 of what is read. */
+type checkingReader struct {
+	r io.Reader
+	h hash.Hash
+}
+
+func newCheckingReader(r io.Reader) *checkingReader {
+	return &checkingReader{r: r, h: sha256.New()}
+}
+
+func (cr *checkingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.h.Write(p[:n])
+	return n, err
+}
+
+/* check returns ErrChecksum if the data read so far is not of sum. */
+func (cr *checkingReader) check(name, sum string) error {
+	if hex.EncodeToString(cr.h.Sum(nil)) != sum {
+		return fmt.Errorf("%w: %s", ErrChecksum, name)
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ynote "github.com/youdao-api/go-ynote"
+	"github.com/youdao-api/go-ynote/ynotetest"
+)
+
+var pngData = []byte("\x89PNG\r\n\x1a\n0000")
+
+/* upload uploads a file of data named name in a temporary directory. */
+func upload(t *testing.T, yc *ynote.YnoteClient, name string, data []byte) *ynote.AttachInfo {
+	fn := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(fn, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	ai, err := yc.UploadAttachment(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ai
+}
+
+/* backupTo backs up s to the file fn, in the format of its name. */
+func backupTo(t *testing.T, s ynote.NoteService, fn string) *Manifest {
+	f, err := os.Create(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	m, err := Backup(context.Background(), s, f, FormatOf(fn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+/* backupIncrementalTo is like backupTo but backs up based on base. */
+func backupIncrementalTo(t *testing.T, s ynote.NoteService, fn, base string) *Manifest {
+	f, err := os.Create(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	m, err := BackupIncremental(context.Background(), s, f, FormatOf(fn), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestBackupRestore(t *testing.T) {
+	for _, ext := range []string{".tar.gz", ".zip"} {
+		srv := ynotetest.NewServer(ynotetest.Consumer)
+		defer srv.Close()
+		yc := srv.Client()
+
+		img := upload(t, yc, "a.png", pngData)
+		pdf := upload(t, yc, "r.pdf", []byte("%PDF-1.4 x"))
+		nb, _ := yc.CreateNotebook("Work", "G")
+		if _, err := yc.CreateNotebook("Empty", ""); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := yc.CreateNote(nb.Path, "n1", "me", "http://src/",
+			`<p><img src="`+img.URL+`"><img src="http://example.com/x.png"></p>`); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := yc.CreateNote(nb.Path, "n2", "", "",
+			`<p><img path="`+pdf.URL+`" src="`+pdf.Src+`"><img src="`+img.URL+
+				`"><img src="`+srv.URL+`/yws/open/resource/download/missing.png"></p>`); err != nil {
+			t.Fatal(err)
+		}
+
+		fn := filepath.Join(t.TempDir(), "backup"+ext)
+		m := backupTo(t, yc, fn)
+		missing := 0
+		for _, r := range m.Resources {
+			if r.Missing {
+				missing++
+			}
+		}
+		if len(m.Notebooks) != 2 || len(m.Resources) != 3 || missing != 1 {
+			t.Fatalf("%s: %d notebooks, %d resources, %d missing", ext,
+				len(m.Notebooks), len(m.Resources), missing)
+		}
+		if _, err := Verify(fn); err != nil {
+			t.Fatalf("%s: Verify: %v", ext, err)
+		}
+
+		srv2 := ynotetest.NewServer(ynotetest.Consumer)
+		defer srv2.Close()
+		yc2 := srv2.Client()
+		r, err := Restore(context.Background(), yc2, fn)
+		if err != nil {
+			t.Fatalf("%s: Restore: %v", ext, err)
+		}
+		if len(r.Notebooks) != 2 || len(r.Notes) != 2 || len(r.Resources) != 2 {
+			t.Fatalf("%s: restored %v", ext, r)
+		}
+
+		nbs, _ := yc2.ListNotebooks()
+		groups := make(map[string]string)
+		for _, nb := range nbs {
+			groups[nb.Name] = nb.Group
+		}
+		if g, ok := groups["Work"]; !ok || g != "G" {
+			t.Errorf("%s: restored notebooks %v", ext, groups)
+		}
+		for _, p := range r.Notes {
+			ni, err := yc2.NoteInfo(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(ni.Content, img.URL) || strings.Contains(ni.Content, pdf.URL) {
+				t.Errorf("%s: resource URLs not rewritten in %q", ext, ni.Content)
+			}
+			if ni.Title == "n1" && (ni.Author != "me" || ni.Source != "http://src/" ||
+				!strings.Contains(ni.Content, "http://example.com/x.png")) {
+				t.Errorf("%s: restored %+v", ext, ni)
+			}
+		}
+
+		var buf bytes.Buffer
+		if _, err := yc2.DownloadAttachment(context.Background(), r.Resources[img.URL], &buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), pngData) {
+			t.Errorf("%s: restored image %q", ext, buf.Bytes())
+		}
+	}
+}
+
+func TestBackupIncremental(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	yc := srv.Client()
+	dir := t.TempDir()
+
+	img := upload(t, yc, "a.png", pngData)
+	keep, _ := yc.CreateNotebook("Keep", "")
+	change, _ := yc.CreateNotebook("Change", "")
+	yc.CreateNote(keep.Path, "k1", "", "", `<p><img src="`+img.URL+`"></p>`)
+	c1, _ := yc.CreateNote(change.Path, "c1", "", "", `<p>one</p>`)
+	yc.CreateNote(change.Path, "c2", "", "", `<p>two</p>`)
+
+	full := filepath.Join(dir, "full.tar.gz")
+	backupTo(t, yc, full)
+
+	// The same image uploaded again is not stored again.
+	img2 := upload(t, yc, "a.png", pngData)
+	yc.UpdateNote(c1, "c1", "", "", `<p>one changed <img src="`+img2.URL+`"></p>`)
+	yc.CreateNote(change.Path, "c3", "", "", `<p>three <img src="`+img.URL+`"></p>`)
+
+	for _, ext := range []string{".zip", ".tar.gz"} {
+		inc := filepath.Join(dir, "inc"+ext)
+		m := backupIncrementalTo(t, yc, inc, full)
+		if m.Base != "full.tar.gz" {
+			t.Errorf("%s: Base = %q", ext, m.Base)
+		}
+		stored := 0
+		for _, nb := range m.Notebooks {
+			for _, n := range nb.Notes {
+				if n.Archive == "" {
+					stored++
+				}
+			}
+		}
+		if stored != 2 {
+			t.Errorf("%s: %d notes stored, want 2", ext, stored)
+		}
+		for _, r := range m.Resources {
+			if r.Archive != "full.tar.gz" {
+				t.Errorf("%s: resource %s stored again", ext, r.URL)
+			}
+		}
+		if _, err := Verify(inc); err != nil {
+			t.Fatalf("%s: Verify: %v", ext, err)
+		}
+
+		srv2 := ynotetest.NewServer(ynotetest.Consumer)
+		defer srv2.Close()
+		r, err := Restore(context.Background(), srv2.Client(), inc)
+		if err != nil {
+			t.Fatalf("%s: Restore: %v", ext, err)
+		}
+		if len(r.Notes) != 4 || len(r.Resources) != 2 {
+			t.Errorf("%s: restored %v", ext, r)
+		}
+	}
+
+	// An incremental backup based on an incremental one stores nothing new.
+	inc2 := filepath.Join(dir, "inc2.tar.gz")
+	m := backupIncrementalTo(t, yc, inc2, filepath.Join(dir, "inc.zip"))
+	for _, nb := range m.Notebooks {
+		for _, n := range nb.Notes {
+			if n.Archive == "" {
+				t.Errorf("note %s stored again", n.Title)
+			}
+		}
+	}
+	if _, err := Verify(inc2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(full); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(inc2); err == nil {
+		t.Error("Verify succeeded without the base archive")
+	}
+}
+
+func TestVerifyCorrupt(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "corrupt.tar.gz")
+	f, err := os.Create(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aw := newArchiveWriter(f, TarGz)
+	m := []byte(`{"version":1,"notebooks":[{"path":"/a","name":"a","notes":[` +
+		`{"path":"/a/b","title":"b","file":"notes/a/b.html","sha256":"00"}]}]}`)
+	writeEntry(aw, ManifestName, m, time.Time{})
+	writeEntry(aw, "notes/a/b.html", []byte("x"), time.Time{})
+	aw.close()
+	f.Close()
+
+	if _, err := Verify(fn); !errors.Is(err, ErrChecksum) {
+		t.Errorf("Verify() = %v, want ErrChecksum", err)
+	}
+
+	if err := ioutil.WriteFile(fn, []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(fn); err != ErrNotArchive {
+		t.Errorf("Verify() = %v, want ErrNotArchive", err)
+	}
+}
+
+func TestNoteEntry(t *testing.T) {
+	if got, want := noteEntry("/nb/Note-1.x_y"), "notes/nb/Note-1.x_y.html"; got != want {
+		t.Errorf("noteEntry: %s, want %s", got, want)
+	}
+
+	seen := make(map[string]string)
+	for _, p := range []string{"/nb/a_b", "/nb/a b", "/nb/a?b", "/nb/a_b~x", "/nb/笔记", "/nb/记笔"} {
+		e := noteEntry(p)
+		if !strings.HasPrefix(e, "notes/nb/") || !strings.HasSuffix(e, ".html") {
+			t.Errorf("noteEntry(%q): %s", p, e)
+		}
+		if other, ok := seen[e]; ok {
+			t.Errorf("%q and %q both stored as %s", p, other, e)
+		}
+		seen[e] = p
+	}
+}
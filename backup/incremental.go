@@ -0,0 +1,165 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	ynote "github.com/youdao-api/go-ynote"
+)
+
+/*
+	BackupIncremental is like Backup but only stores what changed since the
+	backup in archive base, which is in the directory the new archive is
+	written to. The new archive refers to the entries of base, or the
+	archives base refers to, for the rest.
+
+	Notebooks with the same modification time and number of notes as in base
+	are not listed again. In other notebooks, all notes are fetched, but only
+	notes with changed contents are stored. Resources already in base are
+	not downloaded again, and downloaded ones with the same content as one
+	in base are not stored again.
+
+	Restoring the new archive needs base and the archives it refers to. Keep
+	all archives of a chain in the same directory.
+*/
+func BackupIncremental(ctx context.Context, s ynote.NoteService, w io.Writer, format Format, base string) (*Manifest, error) {
+	m, err := ReadManifest(base)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &backuper{ctx: ctx, s: s, contents: make(map[string][]byte),
+		base: newBaseArchive(filepath.Base(base), m)}
+	defer b.cleanup()
+
+	if err := b.collect(); err != nil {
+		return nil, err
+	}
+	if b.m.User != m.User {
+		return nil, fmt.Errorf("backup: base archive is of user %q, not %q",
+			m.User, b.m.User)
+	}
+	if err := b.downloadResources(); err != nil {
+		return nil, err
+	}
+	if err := b.write(w, format); err != nil {
+		return nil, err
+	}
+	return b.m, nil
+}
+
+/*
+	baseArchive indexes the manifest of the archive an incremental backup is
+	based on. The methods are safe on a nil *baseArchive, i.e. for a full
+	backup, finding nothing.
+*/
+type baseArchive struct {
+	name string
+
+	notebooks map[string]*Notebook
+	notes     map[string]*Note
+	resources map[string]*Resource
+	// Resources stored, by SHA-256
+	bySHA map[string]*Resource
+}
+
+func newBaseArchive(name string, m *Manifest) *baseArchive {
+	ba := &baseArchive{
+		name:      name,
+		notebooks: make(map[string]*Notebook),
+		notes:     make(map[string]*Note),
+		resources: make(map[string]*Resource),
+		bySHA:     make(map[string]*Resource),
+	}
+	for _, nb := range m.Notebooks {
+		ba.notebooks[nb.Path] = nb
+		for _, n := range nb.Notes {
+			ba.notes[n.Path] = n
+		}
+	}
+	for _, r := range m.Resources {
+		if r.Missing {
+			continue
+		}
+		ba.resources[r.URL] = r
+		ba.bySHA[r.SHA256] = r
+	}
+	return ba
+}
+
+/* archive returns the archive of an entry of the base archive. */
+func (ba *baseArchive) archive(archive string) string {
+	if archive == "" {
+		return ba.name
+	}
+	return archive
+}
+
+/*
+	unchangedNotes returns the notes of a notebook unchanged since the base
+	archive, or nil if it may have changed.
+*/
+func (ba *baseArchive) unchangedNotes(nbi *ynote.NotebookInfo) []*Note {
+	if ba == nil {
+		return nil
+	}
+	nb, ok := ba.notebooks[nbi.Path]
+	if !ok || !nb.ModifyTime.Equal(nbi.ModifyTime) ||
+		nb.NotesNum != nbi.NotesNum || len(nb.Notes) != nbi.NotesNum {
+		return nil
+	}
+
+	notes := make([]*Note, 0, len(nb.Notes))
+	for _, n := range nb.Notes {
+		cp := *n
+		cp.Archive = ba.archive(n.Archive)
+		notes = append(notes, &cp)
+	}
+	return notes
+}
+
+/*
+	reuseNote points n to the entry in the base archives if the content is
+	unchanged, returning whether it does.
+*/
+func (ba *baseArchive) reuseNote(n *Note) bool {
+	if ba == nil {
+		return false
+	}
+	bn, ok := ba.notes[n.Path]
+	if !ok || bn.SHA256 != n.SHA256 {
+		return false
+	}
+	n.File, n.Archive = bn.File, ba.archive(bn.Archive)
+	return true
+}
+
+/* resource returns the resource of URL u in the base archives, or nil. */
+func (ba *baseArchive) resource(u string) *Resource {
+	if ba == nil {
+		return nil
+	}
+	return ba.copyResource(ba.resources[u])
+}
+
+/*
+	resourceOf returns a resource with the SHA-256 in the base archives, or
+	nil.
+*/
+func (ba *baseArchive) resourceOf(sha string) *Resource {
+	if ba == nil {
+		return nil
+	}
+	return ba.copyResource(ba.bySHA[sha])
+}
+
+func (ba *baseArchive) copyResource(r *Resource) *Resource {
+	if r == nil {
+		return nil
+	}
+	cp := *r
+	cp.Archive = ba.archive(r.Archive)
+	return &cp
+}
@@ -0,0 +1,425 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	ynote "github.com/youdao-api/go-ynote"
+)
+
+/* ErrNoManifest is returned for an archive not starting with a manifest. */
+var ErrNoManifest = errors.New("backup: no manifest at the start of the archive")
+
+/* Restored maps what is in an archive to what is restored. */
+type Restored struct {
+	// New notebook paths by the paths in the archive
+	Notebooks map[string]string
+	// New note paths by the paths in the archive
+	Notes map[string]string
+	// New resource URLs by the URLs in the archive
+	Resources map[string]string
+}
+
+/*
+	ReadManifest returns the manifest of an archive without reading the rest
+	of it.
+*/
+func ReadManifest(filename string) (*Manifest, error) {
+	ar, err := openArchive(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer ar.close()
+
+	return readManifest(ar)
+}
+
+func readManifest(ar archiveReader) (*Manifest, error) {
+	name, _, r, err := ar.next()
+	if err == io.EOF || err == nil && name != ManifestName {
+		return nil, ErrNoManifest
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("backup: invalid manifest: %w", err)
+	}
+	if m.Version > FormatVersion {
+		return nil, fmt.Errorf("backup: unsupported archive version %d", m.Version)
+	}
+	return &m, nil
+}
+
+/* entries indexes the entries of an archive described by a Manifest. */
+type entries struct {
+	// Resources by entry
+	resources map[string][]*Resource
+	// Notes, and their notebooks, by entry
+	notes     map[string]*Note
+	notebooks map[string]*Notebook
+}
+
+/*
+	indexEntries indexes the entries described by m by the archives
+	containing them, "" for the archive of m.
+*/
+func indexEntries(m *Manifest) map[string]*entries {
+	byArchive := make(map[string]*entries)
+	of := func(archive string) *entries {
+		es, ok := byArchive[archive]
+		if !ok {
+			es = &entries{
+				resources: make(map[string][]*Resource),
+				notes:     make(map[string]*Note),
+				notebooks: make(map[string]*Notebook),
+			}
+			byArchive[archive] = es
+		}
+		return es
+	}
+
+	of("")
+	for _, r := range m.Resources {
+		if !r.Missing {
+			es := of(r.Archive)
+			es.resources[r.File] = append(es.resources[r.File], r)
+		}
+	}
+	for _, nb := range m.Notebooks {
+		for _, n := range nb.Notes {
+			es := of(n.Archive)
+			es.notes[n.File] = n
+			es.notebooks[n.File] = nb
+		}
+	}
+	return byArchive
+}
+
+/* otherArchives returns the archives other than "" in byArchive, sorted. */
+func otherArchives(byArchive map[string]*entries) []string {
+	var names []string
+	for name := range byArchive {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+/* sum returns the SHA-256 of an entry. */
+func (es *entries) sum(name string) string {
+	if rs, ok := es.resources[name]; ok {
+		return rs[0].SHA256
+	}
+	return es.notes[name].SHA256
+}
+
+/*
+	scan calls fn for the entries of ar in es, the resources if resources and
+	the notes if notes. An error is returned if any of them is not in ar.
+*/
+func (es *entries) scan(ar archiveReader, archive string, resources, notes bool,
+	fn func(name string, size int64, r io.Reader) error) error {
+	seen := make(map[string]bool)
+	for {
+		name, size, r, err := ar.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		_, isResource := es.resources[name]
+		_, isNote := es.notes[name]
+		if !(isResource && resources || isNote && notes) {
+			continue
+		}
+		if err := fn(name, size, r); err != nil {
+			return err
+		}
+		seen[name] = true
+	}
+
+	var names []string
+	if resources {
+		for name := range es.resources {
+			names = append(names, name)
+		}
+	}
+	if notes {
+		for name := range es.notes {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		if !seen[name] {
+			if archive == "" {
+				return fmt.Errorf("backup: archive incomplete, %s missing", name)
+			}
+			return fmt.Errorf("backup: archive %s incomplete, %s missing",
+				archive, name)
+		}
+	}
+	return nil
+}
+
+/*
+	Verify checks that an archive, and the archives it refers to, are
+	complete and the checksums of all the entries match the manifest, which
+	is returned.
+*/
+func Verify(filename string) (*Manifest, error) {
+	ar, err := openArchive(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer ar.close()
+
+	m, err := readManifest(ar)
+	if err != nil {
+		return nil, err
+	}
+	byArchive := indexEntries(m)
+
+	verify := func(es *entries) func(name string, size int64, r io.Reader) error {
+		return func(name string, size int64, r io.Reader) error {
+			cr := newCheckingReader(r)
+			if _, err := io.Copy(ioutil.Discard, cr); err != nil {
+				return err
+			}
+			return cr.check(name, es.sum(name))
+		}
+	}
+
+	if err := byArchive[""].scan(ar, "", true, true, verify(byArchive[""])); err != nil {
+		return nil, err
+	}
+	for _, name := range otherArchives(byArchive) {
+		es := byArchive[name]
+		err := withArchive(filepath.Join(filepath.Dir(filename), name), func(ar archiveReader) error {
+			return es.scan(ar, name, true, true, verify(es))
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+/* withArchive calls fn with the opened archive file. */
+func withArchive(filename string, fn func(ar archiveReader) error) error {
+	ar, err := openArchive(filename)
+	if err != nil {
+		return err
+	}
+	defer ar.close()
+
+	return fn(ar)
+}
+
+/*
+	Restore recreates the notebooks, notes and resources in an archive via s.
+	The notes are created in the notebooks of the same names and groups,
+	which are created if they do not exist. References to resources in the
+	notes are changed to the uploaded ones.
+
+	For an archive of an incremental backup, the archives it refers to are
+	read from the same directory.
+
+	The creation and modification times are not restored, since the open API
+	does not allow setting them. The checksums are checked while restoring;
+	on a mismatch, ErrChecksum is returned with what is restored so far.
+*/
+func Restore(ctx context.Context, s ynote.NoteService, filename string) (*Restored, error) {
+	ar, err := openArchive(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer ar.close()
+
+	m, err := readManifest(ar)
+	if err != nil {
+		return nil, err
+	}
+
+	rs := &restorer{ctx: ctx, s: s, restored: &Restored{
+		Notebooks: make(map[string]string),
+		Notes:     make(map[string]string),
+		Resources: make(map[string]string),
+	}, icons: make(map[string]string)}
+	if err := rs.findNotebooks(); err != nil {
+		return nil, err
+	}
+
+	// The resources of all archives are restored before the notes referring
+	// to them: those in other archives first, then this archive in a single
+	// pass, and finally the notes in other archives.
+	byArchive := indexEntries(m)
+	others := otherArchives(byArchive)
+	dir := filepath.Dir(filename)
+	for _, name := range others {
+		es := byArchive[name]
+		err := withArchive(filepath.Join(dir, name), func(ar archiveReader) error {
+			return es.scan(ar, name, true, false, rs.restoreEntry(es))
+		})
+		if err != nil {
+			return rs.restored, err
+		}
+	}
+	if err := byArchive[""].scan(ar, "", true, true, rs.restoreEntry(byArchive[""])); err != nil {
+		return rs.restored, err
+	}
+	for _, name := range others {
+		es := byArchive[name]
+		err := withArchive(filepath.Join(dir, name), func(ar archiveReader) error {
+			return es.scan(ar, name, false, true, rs.restoreEntry(es))
+		})
+		if err != nil {
+			return rs.restored, err
+		}
+	}
+
+	// Notebooks without notes
+	for _, nb := range m.Notebooks {
+		if _, err := rs.notebook(nb); err != nil {
+			return rs.restored, err
+		}
+	}
+	return rs.restored, nil
+}
+
+type restorer struct {
+	ctx      context.Context
+	s        ynote.NoteService
+	restored *Restored
+
+	// Paths of existing notebooks by group and name
+	existing map[[2]string]string
+	// New icon URLs of attachments by the URLs in the archive
+	icons map[string]string
+}
+
+func (rs *restorer) findNotebooks() error {
+	nbs, err := rs.s.ListNotebooksContext(rs.ctx)
+	if err != nil {
+		return err
+	}
+	rs.existing = make(map[[2]string]string)
+	for _, nb := range nbs {
+		rs.existing[[2]string{nb.Group, nb.Name}] = nb.Path
+	}
+	return nil
+}
+
+/* restoreEntry returns the function restoring an entry in es. */
+func (rs *restorer) restoreEntry(es *entries) func(name string, size int64, r io.Reader) error {
+	return func(name string, size int64, r io.Reader) error {
+		if res, ok := es.resources[name]; ok {
+			return rs.restoreResource(name, res, r, size)
+		}
+		return rs.restoreNote(name, es.notes[name], es.notebooks[name], r)
+	}
+}
+
+/* notebook returns the path of the notebook to restore nb into. */
+func (rs *restorer) notebook(nb *Notebook) (string, error) {
+	if p, ok := rs.restored.Notebooks[nb.Path]; ok {
+		return p, nil
+	}
+
+	key := [2]string{nb.Group, nb.Name}
+	p, ok := rs.existing[key]
+	if !ok {
+		nbi, err := rs.s.CreateNotebookContext(rs.ctx, nb.Name, nb.Group)
+		if err != nil {
+			return "", err
+		}
+		p = nbi.Path
+		rs.existing[key] = p
+	}
+	rs.restored.Notebooks[nb.Path] = p
+	return p, nil
+}
+
+/* restoreResource uploads a resource entry once for all its URLs. */
+func (rs *restorer) restoreResource(name string, res []*Resource, r io.Reader, size int64) error {
+	cr := newCheckingReader(r)
+	ai, err := rs.s.UploadAttachmentReader(rs.ctx, res[0].Name, cr, size)
+	if err != nil {
+		return err
+	}
+	if err := cr.check(name, res[0].SHA256); err != nil {
+		return err
+	}
+
+	for _, r := range res {
+		rs.restored.Resources[r.URL] = ai.URL
+		if r.Icon != "" && ai.Src != "" {
+			rs.icons[r.Icon] = ai.Src
+		}
+	}
+	return nil
+}
+
+func (rs *restorer) restoreNote(name string, n *Note, nb *Notebook, r io.Reader) error {
+	cr := newCheckingReader(r)
+	content, err := ioutil.ReadAll(cr)
+	if err != nil {
+		return err
+	}
+	if err := cr.check(name, n.SHA256); err != nil {
+		return err
+	}
+
+	nbPath, err := rs.notebook(nb)
+	if err != nil {
+		return err
+	}
+	p, err := rs.s.CreateNoteContext(rs.ctx, nbPath, n.Title, n.Author,
+		n.Source, rs.rewrite(string(content), n.Resources))
+	if err != nil {
+		return err
+	}
+	rs.restored.Notes[n.Path] = p
+	return nil
+}
+
+/* rewrite changes the references to restored resources in content. */
+func (rs *restorer) rewrite(content string, urls []string) string {
+	var pairs []string
+	add := func(u, nu string) {
+		// URLs in attributes are escaped, e.g. & as &amp;.
+		pairs = append(pairs, html.EscapeString(u), html.EscapeString(nu))
+		if esc := html.EscapeString(u); esc != u {
+			pairs = append(pairs, u, nu)
+		}
+	}
+	for _, u := range urls {
+		if nu, ok := rs.restored.Resources[u]; ok {
+			add(u, nu)
+		}
+	}
+	for icon, nicon := range rs.icons {
+		if icon != nicon {
+			add(icon, nicon)
+		}
+	}
+	if len(pairs) == 0 {
+		return content
+	}
+	return strings.NewReplacer(pairs...).Replace(content)
+}
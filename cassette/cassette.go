@@ -0,0 +1,396 @@
+/*
+	Package cassette records HTTP interactions of a *ynote.YnoteClient to a
+	file, and replays them later, so tests can run deterministically against
+	real responses without network access.
+
+	Record once:
+
+		rec := cassette.NewRecorder("testdata/notebooks.json")
+		yc := ynote.NewOnlineYnoteClient(cred, ynote.WithMiddleware(rec.Middleware()))
+		... // call yc
+		err := rec.Save()
+
+	and replay:
+
+		rep, err := cassette.NewReplayer("testdata/notebooks.json")
+		yc := ynote.NewOnlineYnoteClient(cred, ynote.WithMiddleware(rep.Middleware()))
+
+	Requests are matched on method, path, form parameters and the Range
+	header, so a resumed download gets the rest of the content. OAuth
+	parameters (nonces, timestamps, signatures and tokens) are not recorded,
+	and tokens in the responses of the OAuth handshake are redacted.
+*/
+package cassette
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	ynote "github.com/youdao-api/go-ynote"
+)
+
+/* Redacted replaces secrets in a cassette. */
+const Redacted = "REDACTED"
+
+/* Request is the recorded part of an HTTP request. */
+type Request struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Parameters of the query and the body, except the oauth_* ones. Files
+	// of multipart bodies are recorded as "sha256:<hex>" of the content.
+	Form url.Values `json:"form,omitempty"`
+	// The Range header, e.g. of a resumed download
+	Range string `json:"range,omitempty"`
+}
+
+/* Response is a recorded HTTP response. */
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	// The body if it is valid UTF-8, which JSON strings keep intact
+	Body string `json:"body"`
+	// The body otherwise, e.g. a downloaded image, base64 in JSON
+	BinaryBody []byte `json:"body_base64,omitempty"`
+}
+
+/* newResponse returns the Response with body, as text if it is UTF-8. */
+func newResponse(status int, header http.Header, body []byte) Response {
+	res := Response{Status: status, Header: header}
+	if utf8.Valid(body) {
+		res.Body = string(body)
+	} else {
+		res.BinaryBody = body
+	}
+	return res
+}
+
+/* body returns the body of res. */
+func (res *Response) body() []byte {
+	if res.BinaryBody != nil {
+		return res.BinaryBody
+	}
+	return []byte(res.Body)
+}
+
+/* Interaction is a recorded request and its response. */
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+/* Cassette is a list of recorded interactions. */
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+/* Load reads a cassette from a file. */
+func Load(filename string) (*Cassette, error) {
+	js, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(js, &c); err != nil {
+		return nil, fmt.Errorf("cassette: invalid file %s: %w", filename, err)
+	}
+	return &c, nil
+}
+
+/* Save writes the cassette to a file. */
+func (c *Cassette) Save(filename string) error {
+	js, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append(js, '\n'), 0644)
+}
+
+/*
+	readRequest returns the recorded form of req. The body of req is read and
+	replaced with an equivalent one.
+*/
+func readRequest(req *http.Request) (*Request, error) {
+	r := &Request{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Form:   make(url.Values),
+		Range:  req.Header.Get("Range"),
+	}
+	for k, vs := range req.URL.Query() {
+		r.Form[k] = vs
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if err := parseBody(r.Form, req.Header.Get("Content-Type"), body); err != nil {
+			return nil, err
+		}
+	}
+
+	for k := range r.Form {
+		if strings.HasPrefix(k, "oauth_") {
+			delete(r.Form, k)
+		}
+	}
+	if len(r.Form) == 0 {
+		r.Form = nil
+	}
+	return r, nil
+}
+
+/* parseBody adds the parameters of an urlencoded or multipart body to form. */
+func parseBody(form url.Values, contentType string, body []byte) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		vs, err := url.ParseQuery(string(body))
+		if err != nil {
+			return err
+		}
+		for k, v := range vs {
+			form[k] = append(form[k], v...)
+		}
+	case "multipart/form-data":
+		mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			data, err := ioutil.ReadAll(part)
+			if err != nil {
+				return err
+			}
+			v := string(data)
+			if part.FileName() != "" {
+				sum := sha256.Sum256(data)
+				v = "sha256:" + hex.EncodeToString(sum[:])
+			}
+			form.Add(part.FormName(), v)
+		}
+	}
+	return nil
+}
+
+/*
+	redactBody redacts the tokens in the response of the OAuth handshake.
+	Other bodies, e.g. a JSON failure, are returned as they are.
+*/
+func redactBody(path, body string) string {
+	if !strings.HasPrefix(path, "/oauth/") {
+		return body
+	}
+	vs, err := url.ParseQuery(body)
+	if err != nil {
+		return body
+	}
+	redacted := false
+	for _, k := range []string{"oauth_token", "oauth_token_secret"} {
+		if _, ok := vs[k]; ok {
+			vs.Set(k, Redacted)
+			redacted = true
+		}
+	}
+	if !redacted {
+		return body
+	}
+	return vs.Encode()
+}
+
+/*
+	Recorder records the interactions of requests passing its Middleware. It is
+	safe for concurrent use. Request and response bodies are held in memory
+	while recording.
+*/
+type Recorder struct {
+	filename string
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+/* NewRecorder returns a *Recorder saving to filename. */
+func NewRecorder(filename string) *Recorder {
+	return &Recorder{filename: filename}
+}
+
+/* Middleware returns a ynote.Middleware recording the requests passing it. */
+func (rec *Recorder) Middleware() ynote.Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return ynote.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return rec.roundTrip(next, req)
+		})
+	}
+}
+
+func (rec *Recorder) roundTrip(next http.RoundTripper, req *http.Request) (*http.Response, error) {
+	r, err := readRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	header := res.Header.Clone()
+	header.Del("Set-Cookie")
+	header.Del("Content-Length")
+	rec.mu.Lock()
+	rec.cassette.Interactions = append(rec.cassette.Interactions, &Interaction{
+		Request: *r,
+		Response: newResponse(res.StatusCode, header,
+			[]byte(redactBody(r.Path, string(body)))),
+	})
+	rec.mu.Unlock()
+
+	return res, nil
+}
+
+/* Cassette returns a copy of the interactions recorded so far. */
+func (rec *Recorder) Cassette() *Cassette {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	return &Cassette{
+		Interactions: append([]*Interaction(nil), rec.cassette.Interactions...),
+	}
+}
+
+/* Save writes the interactions recorded so far to the file. */
+func (rec *Recorder) Save() error {
+	return rec.Cassette().Save(rec.filename)
+}
+
+/* ErrNoInteraction is returned by a Replayer for an unrecorded request. */
+var ErrNoInteraction = errors.New("cassette: no recorded interaction matches the request")
+
+/*
+	Replayer is an http.RoundTripper answering requests with recorded
+	responses. Every recorded interaction is used once, in the recorded
+	order among those matching a request. It is safe for concurrent use.
+*/
+type Replayer struct {
+	mu       sync.Mutex
+	cassette *Cassette
+	used     []bool
+}
+
+/* NewReplayer returns a *Replayer with the cassette in filename. */
+func NewReplayer(filename string) (*Replayer, error) {
+	c, err := Load(filename)
+	if err != nil {
+		return nil, err
+	}
+	return NewCassetteReplayer(c), nil
+}
+
+/* NewCassetteReplayer returns a *Replayer with the cassette c. */
+func NewCassetteReplayer(c *Cassette) *Replayer {
+	return &Replayer{
+		cassette: c,
+		used:     make([]bool, len(c.Interactions)),
+	}
+}
+
+/*
+	Middleware returns a ynote.Middleware replacing the transport with the
+	Replayer.
+*/
+func (rep *Replayer) Middleware() ynote.Middleware {
+	return func(http.RoundTripper) http.RoundTripper {
+		return rep
+	}
+}
+
+/* Implementation of http.RoundTripper */
+func (rep *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	r, err := readRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	rep.mu.Lock()
+	var found *Interaction
+	for i, in := range rep.cassette.Interactions {
+		if !rep.used[i] && matches(&in.Request, r) {
+			rep.used[i] = true
+			found = in
+			break
+		}
+	}
+	rep.mu.Unlock()
+
+	if found == nil {
+		return nil, fmt.Errorf("%w: %s %s %v", ErrNoInteraction, r.Method, r.Path, r.Form)
+	}
+	body := found.Response.body()
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", found.Response.Status, http.StatusText(found.Response.Status)),
+		StatusCode:    found.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        found.Response.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+/* Remaining returns the number of recorded interactions not used yet. */
+func (rep *Replayer) Remaining() int {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	n := 0
+	for _, used := range rep.used {
+		if !used {
+			n++
+		}
+	}
+	return n
+}
+
+func matches(recorded, r *Request) bool {
+	if recorded.Method != r.Method || recorded.Path != r.Path || recorded.Range != r.Range {
+		return false
+	}
+	if len(recorded.Form) == 0 && len(r.Form) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(recorded.Form, r.Form)
+}
@@ -0,0 +1,143 @@
+package cassette
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ynote "github.com/youdao-api/go-ynote"
+	"github.com/youdao-api/go-ynote/ynotetest"
+)
+
+func TestRecordReplay(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	dir := t.TempDir()
+
+	// Not valid UTF-8, so recorded as base64
+	data := []byte("\x89PNG\r\n\x1a\n\xff\x00")
+	fn := filepath.Join(dir, "a.png")
+	if err := ioutil.WriteFile(fn, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cf := filepath.Join(dir, "cassette.json")
+	rec := NewRecorder(cf)
+	yc := srv.Client(ynote.WithMiddleware(rec.Middleware()))
+	nb, err := yc.CreateNotebook("nb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ai, err := yc.UploadAttachment(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := yc.DownloadAttachment(context.Background(), ai.URL, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	rep, err := NewReplayer(cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := srv.Requests()
+	yc = srv.Client(ynote.WithMiddleware(rep.Middleware()))
+	if got, err := yc.CreateNotebook("nb", ""); err != nil || got.Path != nb.Path {
+		t.Errorf("replayed CreateNotebook: %v, %v, want %v", got, err, nb)
+	}
+	if got, err := yc.UploadAttachment(fn); err != nil || got.URL != ai.URL {
+		t.Errorf("replayed UploadAttachment: %v, %v, want %v", got, err, ai)
+	}
+	buf.Reset()
+	if _, err := yc.DownloadAttachment(context.Background(), ai.URL, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("replayed download: %q, want %q", buf.Bytes(), data)
+	}
+	if n := srv.Requests() - requests; n != 0 {
+		t.Errorf("%d requests reached the server while replaying", n)
+	}
+	if n := rep.Remaining(); n != 0 {
+		t.Errorf("Remaining: %d, want 0", n)
+	}
+
+	if _, err := yc.CreateNotebook("nb", ""); !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("unrecorded request: %v, want ErrNoInteraction", err)
+	}
+}
+
+func TestRecordRedacts(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	rec := NewRecorder(filepath.Join(t.TempDir(), "cassette.json"))
+	yc := srv.Client(ynote.WithMiddleware(rec.Middleware()))
+
+	tmpCred, err := yc.RequestTemporaryCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.InjectFailure(ynotetest.Failure{
+		Path:    "/oauth/request_token",
+		Err:     string(ynote.CodeBadParameter),
+		Message: "invalid oauth_signature=x",
+	})
+	if _, err := yc.RequestTemporaryCredentials(); err == nil {
+		t.Fatal("RequestTemporaryCredentials did not fail")
+	}
+
+	ins := rec.Cassette().Interactions
+	if len(ins) != 2 {
+		t.Fatalf("%d interactions recorded, want 2", len(ins))
+	}
+	body := ins[0].Response.Body
+	if strings.Contains(body, tmpCred.Token) || strings.Contains(body, tmpCred.Secret) {
+		t.Errorf("token not redacted: %q", body)
+	}
+	if !strings.Contains(body, "oauth_token="+Redacted) {
+		t.Errorf("no redacted token in %q", body)
+	}
+	want := `{"error":"1002","message":"invalid oauth_signature=x"}` + "\n"
+	if body := ins[1].Response.Body; body != want {
+		t.Errorf("failure recorded as %q, want %q", body, want)
+	}
+}
+
+func TestReplayRange(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	data := []byte("0123456789")
+	ai, err := srv.Client().UploadAttachmentReader(context.Background(), "a.txt",
+		bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := NewRecorder(filepath.Join(t.TempDir(), "cassette.json"))
+	yc := srv.Client(ynote.WithMiddleware(rec.Middleware()))
+	for _, offset := range []int64{0, 4} {
+		if _, err := yc.DownloadAttachmentFrom(context.Background(), ai.URL, ioutil.Discard, offset); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Replayed in the other order, each gets the content of its range.
+	yc = srv.Client(ynote.WithMiddleware(NewCassetteReplayer(rec.Cassette()).Middleware()))
+	for _, offset := range []int64{4, 0} {
+		var buf bytes.Buffer
+		if _, err := yc.DownloadAttachmentFrom(context.Background(), ai.URL, &buf, offset); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), data[offset:]) {
+			t.Errorf("offset %d: %q, want %q", offset, buf.Bytes(), data[offset:])
+		}
+	}
+}
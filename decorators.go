@@ -0,0 +1,388 @@
+package ynote
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+/*
+	Interceptor is called by a service returned by NewInterceptedService around
+	every operation. op is the name of the operation without the Context
+	suffix, e.g. "NoteInfo". The interceptor should call call, possibly with a
+	derived context, and return its error.
+*/
+type Interceptor func(ctx context.Context, op string, call func(ctx context.Context) error) error
+
+/*
+	NewInterceptedService returns a NoteService calling the operations of s
+	through intercept. AuthorizeDownloadLink, which involves no request, is
+	not intercepted.
+*/
+func NewInterceptedService(s NoteService, intercept Interceptor) NoteService {
+	return &interceptedService{s: s, intercept: intercept}
+}
+
+/*
+	NewLoggingService returns a NoteService logging the name, duration and
+	error of every operation of s to logger. If logger is nil, the standard
+	logger is used.
+*/
+func NewLoggingService(s NoteService, logger *log.Logger) NoteService {
+	if logger == nil {
+		logger = log.New(log.Writer(), log.Prefix(), log.Flags())
+	}
+	return NewInterceptedService(s, func(ctx context.Context, op string, call func(ctx context.Context) error) error {
+		start := time.Now()
+		err := call(ctx)
+		if err != nil {
+			logger.Printf("ynote: %s failed in %v: %v", op, time.Since(start), err)
+		} else {
+			logger.Printf("ynote: %s succeeded in %v", op, time.Since(start))
+		}
+		return err
+	})
+}
+
+/*
+	MetricsFunc receives the name, duration and error of an operation, e.g. to
+	update a histogram and an error counter.
+*/
+type MetricsFunc func(op string, d time.Duration, err error)
+
+/*
+	NewMetricsService returns a NoteService reporting every operation of s to
+	observe.
+*/
+func NewMetricsService(s NoteService, observe MetricsFunc) NoteService {
+	return NewInterceptedService(s, func(ctx context.Context, op string, call func(ctx context.Context) error) error {
+		start := time.Now()
+		err := call(ctx)
+		observe(op, time.Since(start), err)
+		return err
+	})
+}
+
+/* ErrReadOnly is returned by a read-only NoteService for mutating operations. */
+var ErrReadOnly = errors.New("ynote: service is read-only")
+
+/*
+	NewReadOnlyService returns a NoteService failing all mutating operations of
+	s, including uploading attachments, with ErrReadOnly.
+*/
+func NewReadOnlyService(s NoteService) NoteService {
+	return readOnlyService{s}
+}
+
+/*
+	NewCachingService returns a NoteService caching the results of UserInfo,
+	ListNotebooks, ListNotes and NoteInfo of s for ttl. Any mutating operation
+	through it invalidates the whole cache; changes made by others are seen
+	only after ttl. Returned values are copies, so callers may modify them.
+*/
+func NewCachingService(s NoteService, ttl time.Duration) NoteService {
+	return &cachingService{
+		NoteService: s,
+		ttl:         ttl,
+		entries:     make(map[string]cacheEntry),
+	}
+}
+
+type interceptedService struct {
+	s         NoteService
+	intercept Interceptor
+}
+
+func (is *interceptedService) UserInfoContext(ctx context.Context) (ui *UserInfo, err error) {
+	err = is.intercept(ctx, "UserInfo", func(ctx context.Context) error {
+		ui, err = is.s.UserInfoContext(ctx)
+		return err
+	})
+	return ui, err
+}
+
+func (is *interceptedService) CreateNotebookContext(ctx context.Context, name, group string) (nb *NotebookInfo, err error) {
+	err = is.intercept(ctx, "CreateNotebook", func(ctx context.Context) error {
+		nb, err = is.s.CreateNotebookContext(ctx, name, group)
+		return err
+	})
+	return nb, err
+}
+
+func (is *interceptedService) ListNotebooksContext(ctx context.Context) (nbs []*NotebookInfo, err error) {
+	err = is.intercept(ctx, "ListNotebooks", func(ctx context.Context) error {
+		nbs, err = is.s.ListNotebooksContext(ctx)
+		return err
+	})
+	return nbs, err
+}
+
+func (is *interceptedService) DeleteNotebookContext(ctx context.Context, path string) error {
+	return is.intercept(ctx, "DeleteNotebook", func(ctx context.Context) error {
+		return is.s.DeleteNotebookContext(ctx, path)
+	})
+}
+
+func (is *interceptedService) CreateNoteContext(ctx context.Context, notebookPath, title, author, source, content string) (path string, err error) {
+	err = is.intercept(ctx, "CreateNote", func(ctx context.Context) error {
+		path, err = is.s.CreateNoteContext(ctx, notebookPath, title, author, source, content)
+		return err
+	})
+	return path, err
+}
+
+func (is *interceptedService) ListNotesContext(ctx context.Context, notebookPath string) (notes []string, err error) {
+	err = is.intercept(ctx, "ListNotes", func(ctx context.Context) error {
+		notes, err = is.s.ListNotesContext(ctx, notebookPath)
+		return err
+	})
+	return notes, err
+}
+
+func (is *interceptedService) NoteInfoContext(ctx context.Context, path string) (ni *NoteInfo, err error) {
+	err = is.intercept(ctx, "NoteInfo", func(ctx context.Context) error {
+		ni, err = is.s.NoteInfoContext(ctx, path)
+		return err
+	})
+	return ni, err
+}
+
+func (is *interceptedService) UpdateNoteContext(ctx context.Context, path, title, author, source, content string) error {
+	return is.intercept(ctx, "UpdateNote", func(ctx context.Context) error {
+		return is.s.UpdateNoteContext(ctx, path, title, author, source, content)
+	})
+}
+
+func (is *interceptedService) DeleteNoteContext(ctx context.Context, path string) error {
+	return is.intercept(ctx, "DeleteNote", func(ctx context.Context) error {
+		return is.s.DeleteNoteContext(ctx, path)
+	})
+}
+
+func (is *interceptedService) MoveNoteContext(ctx context.Context, notePath, notebookPath string) error {
+	return is.intercept(ctx, "MoveNote", func(ctx context.Context) error {
+		return is.s.MoveNoteContext(ctx, notePath, notebookPath)
+	})
+}
+
+func (is *interceptedService) UploadAttachmentContext(ctx context.Context, filename string) (ai *AttachInfo, err error) {
+	err = is.intercept(ctx, "UploadAttachment", func(ctx context.Context) error {
+		ai, err = is.s.UploadAttachmentContext(ctx, filename)
+		return err
+	})
+	return ai, err
+}
+
+func (is *interceptedService) UploadAttachmentReader(ctx context.Context, name string, r io.Reader, size int64) (ai *AttachInfo, err error) {
+	err = is.intercept(ctx, "UploadAttachmentReader", func(ctx context.Context) error {
+		ai, err = is.s.UploadAttachmentReader(ctx, name, r, size)
+		return err
+	})
+	return ai, err
+}
+
+func (is *interceptedService) AuthorizeDownloadLink(link string) string {
+	return is.s.AuthorizeDownloadLink(link)
+}
+
+func (is *interceptedService) DownloadAttachment(ctx context.Context, link string, w io.Writer) (n int64, err error) {
+	err = is.intercept(ctx, "DownloadAttachment", func(ctx context.Context) error {
+		n, err = is.s.DownloadAttachment(ctx, link, w)
+		return err
+	})
+	return n, err
+}
+
+type readOnlyService struct {
+	NoteService
+}
+
+func (readOnlyService) CreateNotebookContext(ctx context.Context, name, group string) (*NotebookInfo, error) {
+	return nil, ErrReadOnly
+}
+
+func (readOnlyService) DeleteNotebookContext(ctx context.Context, path string) error {
+	return ErrReadOnly
+}
+
+func (readOnlyService) CreateNoteContext(ctx context.Context, notebookPath, title, author, source, content string) (string, error) {
+	return "", ErrReadOnly
+}
+
+func (readOnlyService) UpdateNoteContext(ctx context.Context, path, title, author, source, content string) error {
+	return ErrReadOnly
+}
+
+func (readOnlyService) DeleteNoteContext(ctx context.Context, path string) error {
+	return ErrReadOnly
+}
+
+func (readOnlyService) MoveNoteContext(ctx context.Context, notePath, notebookPath string) error {
+	return ErrReadOnly
+}
+
+func (readOnlyService) UploadAttachmentContext(ctx context.Context, filename string) (*AttachInfo, error) {
+	return nil, ErrReadOnly
+}
+
+func (readOnlyService) UploadAttachmentReader(ctx context.Context, name string, r io.Reader, size int64) (*AttachInfo, error) {
+	return nil, ErrReadOnly
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+type cachingService struct {
+	NoteService
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	// Incremented by invalidate, so results of reads started before are not
+	// cached.
+	generation int
+}
+
+/*
+	get returns the cached value of key, and the generation to pass to put if
+	it is not cached.
+*/
+func (cs *cachingService) get(key string) (value interface{}, generation int, ok bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	e, ok := cs.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		return nil, cs.generation, false
+	}
+	return e.value, cs.generation, true
+}
+
+func (cs *cachingService) put(key string, generation int, value interface{}) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if generation == cs.generation {
+		cs.entries[key] = cacheEntry{value: value, expires: time.Now().Add(cs.ttl)}
+	}
+}
+
+func (cs *cachingService) invalidate() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.entries = make(map[string]cacheEntry)
+	cs.generation++
+}
+
+func copyNotebooks(nbs []*NotebookInfo) []*NotebookInfo {
+	cp := make([]*NotebookInfo, len(nbs))
+	for i, nb := range nbs {
+		c := *nb
+		cp[i] = &c
+	}
+	return cp
+}
+
+func (cs *cachingService) UserInfoContext(ctx context.Context) (*UserInfo, error) {
+	v, gen, ok := cs.get("user")
+	if ok {
+		ui := *v.(*UserInfo)
+		return &ui, nil
+	}
+	ui, err := cs.NoteService.UserInfoContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c := *ui
+	cs.put("user", gen, &c)
+	return ui, nil
+}
+
+func (cs *cachingService) ListNotebooksContext(ctx context.Context) ([]*NotebookInfo, error) {
+	v, gen, ok := cs.get("notebooks")
+	if ok {
+		return copyNotebooks(v.([]*NotebookInfo)), nil
+	}
+	nbs, err := cs.NoteService.ListNotebooksContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cs.put("notebooks", gen, copyNotebooks(nbs))
+	return nbs, nil
+}
+
+func (cs *cachingService) ListNotesContext(ctx context.Context, notebookPath string) ([]string, error) {
+	key := "notes:" + notebookPath
+	v, gen, ok := cs.get(key)
+	if ok {
+		return append([]string(nil), v.([]string)...), nil
+	}
+	notes, err := cs.NoteService.ListNotesContext(ctx, notebookPath)
+	if err != nil {
+		return nil, err
+	}
+	cs.put(key, gen, append([]string(nil), notes...))
+	return notes, nil
+}
+
+func (cs *cachingService) NoteInfoContext(ctx context.Context, path string) (*NoteInfo, error) {
+	key := "note:" + path
+	v, gen, ok := cs.get(key)
+	if ok {
+		ni := *v.(*NoteInfo)
+		return &ni, nil
+	}
+	ni, err := cs.NoteService.NoteInfoContext(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	c := *ni
+	cs.put(key, gen, &c)
+	return ni, nil
+}
+
+func (cs *cachingService) CreateNotebookContext(ctx context.Context, name, group string) (*NotebookInfo, error) {
+	defer cs.invalidate()
+	return cs.NoteService.CreateNotebookContext(ctx, name, group)
+}
+
+func (cs *cachingService) DeleteNotebookContext(ctx context.Context, path string) error {
+	defer cs.invalidate()
+	return cs.NoteService.DeleteNotebookContext(ctx, path)
+}
+
+func (cs *cachingService) CreateNoteContext(ctx context.Context, notebookPath, title, author, source, content string) (string, error) {
+	defer cs.invalidate()
+	return cs.NoteService.CreateNoteContext(ctx, notebookPath, title, author, source, content)
+}
+
+func (cs *cachingService) UpdateNoteContext(ctx context.Context, path, title, author, source, content string) error {
+	defer cs.invalidate()
+	return cs.NoteService.UpdateNoteContext(ctx, path, title, author, source, content)
+}
+
+func (cs *cachingService) DeleteNoteContext(ctx context.Context, path string) error {
+	defer cs.invalidate()
+	return cs.NoteService.DeleteNoteContext(ctx, path)
+}
+
+func (cs *cachingService) MoveNoteContext(ctx context.Context, notePath, notebookPath string) error {
+	defer cs.invalidate()
+	return cs.NoteService.MoveNoteContext(ctx, notePath, notebookPath)
+}
+
+func (cs *cachingService) UploadAttachmentContext(ctx context.Context, filename string) (*AttachInfo, error) {
+	defer cs.invalidate()
+	return cs.NoteService.UploadAttachmentContext(ctx, filename)
+}
+
+func (cs *cachingService) UploadAttachmentReader(ctx context.Context, name string, r io.Reader, size int64) (*AttachInfo, error) {
+	defer cs.invalidate()
+	return cs.NoteService.UploadAttachmentReader(ctx, name, r, size)
+}
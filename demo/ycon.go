@@ -2,96 +2,250 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/golangplus/sort"
 
-	"github.com/daviddengcn/go-villa"
 	ynote "github.com/youdao-api/go-ynote"
+	"github.com/youdao-api/go-ynote/backup"
+	"github.com/youdao-api/go-ynote/enex"
+	"github.com/youdao-api/go-ynote/notecontent"
+	"github.com/youdao-api/go-ynote/notemarkdown"
+	"github.com/youdao-api/go-ynote/notesync"
 )
 
-const ac_FILENAME = villa.Path("at.json")
+// The access token is saved in ./at.json
+const ac_ACCOUNT = "at"
 
-func readAccToken() *ynote.Credentials {
-	js, err := ac_FILENAME.ReadFile()
+func openBrowser(url string) error {
+	fmt.Println(url)
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", url).Start()
+	case "windows":
+		return exec.Command("cmd", "/d", "/c", "start", url).Start()
+	case "linux":
+		return exec.Command("xdg-open", url).Start()
+	}
+	return nil
+}
+
+func requestForAccess(yc *ynote.YnoteClient) {
+	fmt.Println("Access token (" + ac_ACCOUNT +
+		".json) not found, try authorize...")
+	fmt.Println("Please authorize in the browser ...")
+	accToken, err := yc.AuthorizeLocally(context.Background(), 5*time.Minute,
+		openBrowser)
 	if err != nil {
-		return nil
+		log.Fatal("Authorize failed: ", err)
+		return
 	}
 
-	var cred ynote.Credentials
-	err = json.Unmarshal(js, &cred)
+	fmt.Println(accToken)
+}
+
+func downloadAttachment(yc *ynote.YnoteClient, link string) {
+	fn := path.Base(link)
+	f, err := os.Create(fn)
 	if err != nil {
-		return nil
+		fmt.Println("Create file failed:", err)
+		return
 	}
-	return &cred
+	defer f.Close()
+
+	n, err := yc.DownloadAttachment(context.Background(), link, f)
+	if err != nil {
+		fmt.Println("DownloadAttachment failed:", err)
+		return
+	}
+	fmt.Printf("%d bytes saved to %s\n", n, fn)
 }
 
-func saveAccToken(ac *ynote.Credentials) {
-	js, err := json.Marshal(ac)
+// createMarkdownNote creates a note from a Markdown file, uploading its images.
+// The title is the one in the front matter, or the file name.
+func createMarkdownNote(yc *ynote.YnoteClient, notebookPath, fn string) {
+	src, err := ioutil.ReadFile(fn)
 	if err != nil {
-		log.Fatal("Marshal accToken failed:", err)
+		fmt.Println("Read file failed:", err)
 		return
 	}
-	err = ac_FILENAME.WriteFile(js, 0666)
+	content, err := notemarkdown.Convert(context.Background(), yc,
+		filepath.Dir(fn), src)
 	if err != nil {
-		log.Fatal("Write accToken failed:", err)
+		fmt.Println("Convert failed:", err)
+		return
+	}
+	title, author, source := strings.TrimSuffix(filepath.Base(fn), filepath.Ext(fn)), "ycon", ""
+	if fm, _ := notemarkdown.SplitFrontMatter(src); fm != nil {
+		if fm.Title != "" {
+			title = fm.Title
+		}
+		if fm.Author != "" {
+			author = fm.Author
+		}
+		source = fm.Source
 	}
+	path, err := yc.CreateNote(notebookPath, title, author, source, content)
+	if err != nil {
+		fmt.Println("CreateNote failed:", err)
+		return
+	}
+	fmt.Println("CreateNote:", path)
 }
 
-func requestForAccess(yc *ynote.YnoteClient) {
-	fmt.Println("Access token (" + ac_FILENAME +
-		") not found, try authorize...")
-	fmt.Println("Requesting temporary credentials ...")
-	tmpCred, err := yc.RequestTemporaryCredentials()
+// exportMarkdown saves a note as a Markdown file, with images in ./assets.
+func exportMarkdown(yc *ynote.YnoteClient, ni *ynote.NoteInfo, fn string) {
+	md, err := notemarkdown.Export(context.Background(), yc, ni,
+		filepath.Dir(fn), "assets")
 	if err != nil {
-		log.Fatal("RequestTemporaryCredentials failed: ", err)
+		fmt.Println("Export failed:", err)
+		return
 	}
-	fmt.Println("Temporary credentials got:", tmpCred)
+	if err := ioutil.WriteFile(fn, []byte(md), 0644); err != nil {
+		fmt.Println("Write file failed:", err)
+		return
+	}
+	fmt.Println("Exported to", fn)
+}
 
-	authUrl := yc.AuthorizationURL(tmpCred)
-	fmt.Println(authUrl)
-	switch runtime.GOOS {
-	case "darwin":
-		exec.Command("open", authUrl).Start()
-	case "windows":
-		exec.Command("cmd", "/d", "/c", "start", authUrl).Start()
-	case "linux":
-		exec.Command("xdg-open", authUrl).Start()
+// backupAccount backs up all notebooks to an archive file, incrementally
+// if base is not empty.
+func backupAccount(yc *ynote.YnoteClient, fn, base string) {
+	f, err := os.Create(fn)
+	if err != nil {
+		fmt.Println("Create file failed:", err)
+		return
+	}
+	var m *backup.Manifest
+	if base != "" {
+		m, err = backup.BackupIncremental(context.Background(), yc, f,
+			backup.FormatOf(fn), base)
+	} else {
+		m, err = backup.Backup(context.Background(), yc, f, backup.FormatOf(fn))
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Println("Backup failed:", err)
+		os.Remove(fn)
+		return
 	}
+	notes := 0
+	for _, nb := range m.Notebooks {
+		notes += len(nb.Notes)
+	}
+	fmt.Printf("%d notebooks, %d notes and %d resources backed up to %s\n",
+		len(m.Notebooks), notes, len(m.Resources), fn)
+}
 
-	fmt.Print("Please input the verifier: ")
-	verifier, err := bufio.NewReader(os.Stdin).ReadString('\n')
+// restoreAccount restores notebooks and notes from an archive file.
+func restoreAccount(yc *ynote.YnoteClient, fn string) {
+	restored, err := backup.Restore(context.Background(), yc, fn)
+	if restored != nil {
+		fmt.Printf("%d notes and %d resources restored\n",
+			len(restored.Notes), len(restored.Resources))
+	}
+	if err != nil {
+		fmt.Println("Restore failed:", err)
+	}
+}
 
+// importEnex imports an Evernote export file into a new notebook named
+// after it.
+func importEnex(yc *ynote.YnoteClient, fn string) {
+	f, err := os.Open(fn)
 	if err != nil {
-		log.Fatal("Read verifier from console failed: ", err)
+		fmt.Println("Open file failed:", err)
+		return
 	}
+	defer f.Close()
 
-	verifier = strings.TrimSpace(verifier)
-	fmt.Println("verifier:", verifier)
+	name := strings.TrimSuffix(filepath.Base(fn), filepath.Ext(fn))
+	imported, err := enex.Import(context.Background(), yc, f, name, "")
+	if imported != nil {
+		fmt.Printf("%d notes and %d resources imported into %s\n",
+			len(imported.Notes), imported.Resources, name)
+	}
+	if err != nil {
+		fmt.Println("Import failed:", err)
+	}
+}
 
-	accToken, err := yc.RequestToken(tmpCred, verifier)
+// exportEnex exports the notes of a notebook to an Evernote export file.
+func exportEnex(yc *ynote.YnoteClient, nbi *ynote.NotebookInfo, fn string) {
+	f, err := os.Create(fn)
 	if err != nil {
-		log.Fatal("RequestToken failed: ", err)
+		fmt.Println("Create file failed:", err)
 		return
 	}
+	err = enex.Export(context.Background(), yc, nbi, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Println("Export failed:", err)
+		os.Remove(fn)
+		return
+	}
+	fmt.Println("Exported to", fn)
+}
 
-	fmt.Println(accToken)
-	saveAccToken(accToken)
+// syncNotebooks syncs all notebooks with a local directory.
+func syncNotebooks(yc *ynote.YnoteClient, dir string) {
+	report, err := notesync.New(yc, dir).Sync(context.Background())
+	if report != nil {
+		for _, c := range report.Changes {
+			fmt.Println(c)
+		}
+		for _, c := range report.Conflicts {
+			fmt.Println("Conflict:", c)
+		}
+	}
+	if err != nil {
+		fmt.Println("Sync failed:", err)
+	}
+}
+
+// patchNote applies patch unless the note was modified since ni was fetched.
+func patchNote(yc *ynote.YnoteClient, notePath string, ni *ynote.NoteInfo,
+	patch ynote.NotePatch) {
+	patch.ModifyTime = ni.ModifyTime
+	err := yc.PatchNote(notePath, patch)
+	if errors.Is(err, ynote.ErrNoteModified) {
+		fmt.Println("Note was modified by others, try again.")
+		return
+	}
+	if err != nil {
+		fmt.Println("PatchNote failed:", err)
+	}
 }
 
 func main() {
 	yc := ynote.NewOnlineYnoteClient(ynote.Credentials{
 		Token:  "e13d9c47ee9f332c2cb53828e81c5e8f",
-		Secret: "3e37b6c79413014d482e4e00b86a041f"})
-
-	yc.AccToken = readAccToken()
+		Secret: "3e37b6c79413014d482e4e00b86a041f"},
+		// Listing a notebook calls NoteInfo for every note.
+		ynote.WithRateLimit(ynote.NoteEndpoints, ynote.RateLimit{Rate: 5, Burst: 10}),
+		ynote.WithTokenStore(ynote.NewFileTokenStore("."), ac_ACCOUNT),
+		// Maybe token changed
+		ynote.WithReauthorize(func(ctx context.Context,
+			yc *ynote.YnoteClient) (*ynote.Credentials, error) {
+			fmt.Println("Access token expired, try authorize again...")
+			return yc.AuthorizeLocally(ctx, 5*time.Minute, openBrowser)
+		}))
 
 	if yc.AccToken == nil {
 		requestForAccess(yc)
@@ -99,17 +253,7 @@ func main() {
 
 	ui, err := yc.UserInfo()
 	if err != nil {
-		if fi, ok := err.(*ynote.FailInfo); ok && fi.Err == "1007" {
-			// Maybe token changed
-			requestForAccess(yc)
-			// Try fetch userinfo again
-			ui, err = yc.UserInfo()
-			if err != nil {
-				log.Fatal("UserInfo failed:", err)
-			}
-		} else {
-			log.Fatal("UserInfo failed:", err)
-		}
+		log.Fatal("UserInfo failed:", err)
 	}
 	fmt.Printf("Hi, %s(last login at %v)\n", ui.User, ui.LastLoginTime)
 
@@ -167,7 +311,11 @@ mainloop:
 			if len(nbs) > 0 {
 				fmt.Printf("%d-%d: View notebook, ", 1, len(nbs))
 			}
-			fmt.Println("q: quit")
+			fmt.Println("sync <dir>: sync notebooks with a directory, " +
+				"backup <file> [base]: back up to a .tar.gz/.zip file, " +
+				"incrementally to base in the same directory, " +
+				"restore <file>: restore from a backup, " +
+				"enex <file>: import an Evernote export, q: quit")
 			cmd, err := bufio.NewReader(os.Stdin).ReadString('\n')
 			if err != nil {
 				fmt.Println("Read console failed:", err)
@@ -179,6 +327,38 @@ mainloop:
 			case "q":
 				break mainloop
 			default:
+				if strings.HasPrefix(cmd, "backup ") {
+					args := strings.Fields(cmd[len("backup "):])
+					if len(args) == 1 || len(args) == 2 {
+						base := ""
+						if len(args) == 2 {
+							base = filepath.Join(filepath.Dir(args[0]), args[1])
+						}
+						backupAccount(yc, args[0], base)
+						break
+					}
+				}
+				if strings.HasPrefix(cmd, "restore ") {
+					fn := strings.TrimSpace(cmd[len("restore "):])
+					if len(fn) > 0 {
+						restoreAccount(yc, fn)
+						break
+					}
+				}
+				if strings.HasPrefix(cmd, "enex ") {
+					fn := strings.TrimSpace(cmd[len("enex "):])
+					if len(fn) > 0 {
+						importEnex(yc, fn)
+						break
+					}
+				}
+				if strings.HasPrefix(cmd, "sync ") {
+					dir := strings.TrimSpace(cmd[len("sync "):])
+					if len(dir) > 0 {
+						syncNotebooks(yc, dir)
+						break
+					}
+				}
 				idx, err := strconv.Atoi(cmd)
 				if err == nil && idx >= 1 && idx <= len(nbs) {
 					status = pos_NOTEBOOK
@@ -211,7 +391,9 @@ mainloop:
 			}
 			fmt.Println("a: all notebooks, q: quit, " +
 				"delete: delete the nootbook, put <filename>: add a note " +
-				"with a file as its attachment.")
+				"with a file as its attachment, md <filename>: add a note " +
+				"from a Markdown file, enex <filename>: export the notebook " +
+				"to an Evernote export file.")
 			cmd, err := bufio.NewReader(os.Stdin).ReadString('\n')
 			if err != nil {
 				fmt.Println("Read console failed:", err)
@@ -233,6 +415,20 @@ mainloop:
 				fmt.Println("DeleteNotebook succeed")
 				status = pos_ALL
 			default:
+				if strings.HasPrefix(cmd, "md ") {
+					fn := strings.TrimSpace(cmd[len("md "):])
+					if len(fn) > 0 {
+						createMarkdownNote(yc, notebook.Path, fn)
+						break
+					}
+				}
+				if strings.HasPrefix(cmd, "enex ") {
+					fn := strings.TrimSpace(cmd[len("enex "):])
+					if len(fn) > 0 {
+						exportEnex(yc, notebook, fn)
+						break
+					}
+				}
 				if strings.HasPrefix(cmd, "put ") {
 					fn := strings.TrimSpace(cmd[len("put "):])
 					if len(fn) > 0 {
@@ -242,18 +438,11 @@ mainloop:
 							break
 						}
 
-						var content string
-						if ai.Src == "" {
-							// an image
-							content = fmt.Sprintf(`<img src="%s">`,
-								ai.URL)
-						} else {
-							// common attachment
-							content = fmt.Sprintf(`<img path="%s" src="%s">`,
-								ai.URL, ai.Src)
-						}
+						doc := &notecontent.Document{Blocks: []notecontent.Block{
+							notecontent.NewParagraph(notecontent.FromAttachInfo(ai)),
+						}}
 						path, err := yc.CreateNote(notebook.Path, fn, "ycon",
-							"", content)
+							"", doc.Render())
 						if err != nil {
 							fmt.Println("CreateNote failed:", err)
 							break
@@ -290,7 +479,8 @@ mainloop:
 			fmt.Println("a: all notebooks, n: notebook, q: quit, delete: " +
 				"delete current note, title/author/source <content>: change " +
 				"title/author/source, content: show content, adl <link>: " +
-				"authorize download link")
+				"authorize download link, dl <link>: download attachment, " +
+				"md <filename>: export to a Markdown file")
 			cmd, err := bufio.NewReader(os.Stdin).ReadString('\n')
 			if err != nil {
 				fmt.Println("Read console failed:", err)
@@ -319,37 +509,38 @@ mainloop:
 					newTitle := strings.TrimSpace(cmd[len("title "):])
 					if len(newTitle) > 0 {
 						fmt.Println("Change title to", newTitle)
-						err := yc.UpdateNote(notePath, newTitle, ni.Author,
-							ni.Source, ni.Content)
-						if err != nil {
-							fmt.Println("UpdateNote failed:", err)
-						}
+						patchNote(yc, notePath, ni, ynote.NotePatch{
+							Title: ynote.String(newTitle)})
 					}
 				} else if strings.HasPrefix(cmd, "author ") {
 					newAuthor := strings.TrimSpace(cmd[len("author "):])
 					if len(newAuthor) > 0 {
 						fmt.Println("Change author to", newAuthor)
-						err := yc.UpdateNote(notePath, ni.Title, newAuthor,
-							ni.Source, ni.Content)
-						if err != nil {
-							fmt.Println("UpdateNote failed:", err)
-						}
+						patchNote(yc, notePath, ni, ynote.NotePatch{
+							Author: ynote.String(newAuthor)})
 					}
 				} else if strings.HasPrefix(cmd, "source ") {
-					newSource := strings.TrimSpace(cmd[len("soruce "):])
+					newSource := strings.TrimSpace(cmd[len("source "):])
 					if len(newSource) > 0 {
 						fmt.Println("Change source to", newSource)
-						err := yc.UpdateNote(notePath, ni.Title, ni.Author,
-							newSource, ni.Content)
-						if err != nil {
-							fmt.Println("UpdateNote failed:", err)
-						}
+						patchNote(yc, notePath, ni, ynote.NotePatch{
+							Source: ynote.String(newSource)})
 					}
 				} else if strings.HasPrefix(cmd, "adl ") {
 					url := strings.TrimSpace(cmd[len("adl "):])
 					if len(url) > 0 {
 						fmt.Println(yc.AuthorizeDownloadLink(url))
 					}
+				} else if strings.HasPrefix(cmd, "md ") {
+					fn := strings.TrimSpace(cmd[len("md "):])
+					if len(fn) > 0 {
+						exportMarkdown(yc, ni, fn)
+					}
+				} else if strings.HasPrefix(cmd, "dl ") {
+					link := strings.TrimSpace(cmd[len("dl "):])
+					if len(link) > 0 {
+						downloadAttachment(yc, link)
+					}
 				}
 			}
 		}
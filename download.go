@@ -0,0 +1,184 @@
+package ynote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+/*
+	DownloadAttachment downloads the attachment of a download link in the
+	content of a note, and writes its content to w. The number of bytes written
+	is returned.
+
+	The request is signed as AuthorizeDownloadLink does. If the transfer is
+	interrupted, or shorter than the Content-Length of the response, it is
+	resumed with a Range request, as long as the retry policy of yc allows
+	another attempt.
+*/
+func (yc *YnoteClient) DownloadAttachment(ctx context.Context, link string, w io.Writer) (int64, error) {
+	return yc.DownloadAttachmentFrom(ctx, link, w, 0)
+}
+
+/*
+	DownloadAttachmentFrom is like DownloadAttachment but starts from offset of
+	the content, e.g. to resume a download saved partially in an earlier run.
+	Only the content after offset is written to w. If offset is the size of
+	the content, i.e. the download is already complete, nothing is written
+	and nil is returned.
+*/
+func (yc *YnoteClient) DownloadAttachmentFrom(ctx context.Context, link string, w io.Writer, offset int64) (written int64, err error) {
+	err = yc.withReauthorize(ctx, func() error {
+		n, err := yc.downloadWithResume(ctx, link, w, offset+written)
+		written += n
+		return err
+	})
+	return written, err
+}
+
+func (yc *YnoteClient) downloadWithResume(ctx context.Context, link string, w io.Writer, offset int64) (int64, error) {
+	var written int64
+	for attempt := 1; ; attempt++ {
+		n, err := yc.downloadOnce(ctx, link, w, offset+written)
+		written += n
+		if err == nil {
+			return written, nil
+		}
+		if _, ok := err.(*downloadError); !ok || attempt >= yc.retryPolicy.MaxAttempts || ctx.Err() != nil {
+			if de, ok := err.(*downloadError); ok {
+				err = de.err
+			}
+			return written, err
+		}
+		if err := yc.retryPolicy.sleep(ctx, attempt, 0); err != nil {
+			return written, err
+		}
+	}
+}
+
+/*
+	downloadError wraps an error which interrupted a download, after which the
+	download can be resumed.
+*/
+type downloadError struct {
+	err error
+}
+
+func (e *downloadError) Error() string {
+	return e.err.Error()
+}
+
+func (e *downloadError) Unwrap() error {
+	return e.err
+}
+
+/* writerOf records the error returned by w, so it is not taken as resumable. */
+type writerOf struct {
+	w   io.Writer
+	err error
+}
+
+func (wo *writerOf) Write(p []byte) (int, error) {
+	n, err := wo.w.Write(p)
+	if err != nil {
+		wo.err = err
+	}
+	return n, err
+}
+
+/*
+	downloadOnce downloads the content of link from offset and writes it to w.
+	Resumable failures are returned as *downloadError.
+*/
+func (yc *YnoteClient) downloadOnce(ctx context.Context, link string, w io.Writer, offset int64) (int64, error) {
+	if err := yc.waitRateLimit(ctx, familyOf(link)); err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", yc.AuthorizeDownloadLink(link), nil)
+	if err != nil {
+		return 0, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	res, err := yc.client().Do(req)
+	if err != nil {
+		return 0, &downloadError{err}
+	}
+	defer res.Body.Close()
+
+	// Number of bytes to discard, if the server ignored the Range header.
+	var skip int64
+	switch {
+	case res.StatusCode == http.StatusPartialContent:
+		start, err := contentRangeStart(res.Header.Get("Content-Range"))
+		if err != nil {
+			return 0, err
+		}
+		if start != offset {
+			return 0, fmt.Errorf("ynote: requested range from %d, got from %d", offset, start)
+		}
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		skip = offset
+	case res.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0 &&
+		res.Header.Get("Content-Range") == fmt.Sprintf("bytes */%d", offset):
+		// Nothing is left after offset.
+		return 0, nil
+	default:
+		js, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return 0, &downloadError{err}
+		}
+		_, err = checkResponse(res, js)
+		if isTransientStatus(res.StatusCode, js) {
+			return 0, &downloadError{err}
+		}
+		return 0, err
+	}
+
+	if skip > 0 {
+		if _, err := io.CopyN(ioutil.Discard, res.Body, skip); err != nil {
+			return 0, &downloadError{err}
+		}
+	}
+
+	var body io.Reader = res.Body
+	total := int64(-1)
+	if res.ContentLength >= 0 {
+		total = offset + res.ContentLength - skip
+	}
+	if yc.progress != nil {
+		body = &progressReader{r: body, name: path.Base(link), done: offset, total: total, progress: yc.progress}
+	}
+
+	wo := &writerOf{w: w}
+	n, err := io.Copy(wo, body)
+	if err != nil {
+		if wo.err != nil {
+			return n, wo.err
+		}
+		return n, &downloadError{err}
+	}
+	if res.ContentLength >= 0 && n != res.ContentLength-skip {
+		return n, &downloadError{io.ErrUnexpectedEOF}
+	}
+	return n, nil
+}
+
+/* contentRangeStart returns the first byte position of a Content-Range header. */
+func contentRangeStart(contentRange string) (int64, error) {
+	// bytes <start>-<end>/<total>
+	spec := strings.TrimPrefix(contentRange, "bytes ")
+	idx := strings.Index(spec, "-")
+	if spec == contentRange || idx < 0 {
+		return 0, fmt.Errorf("ynote: invalid Content-Range: %q", contentRange)
+	}
+	return strconv.ParseInt(spec[:idx], 10, 64)
+}
@@ -0,0 +1,122 @@
+package ynote_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	ynote "github.com/youdao-api/go-ynote"
+	"github.com/youdao-api/go-ynote/ynotetest"
+)
+
+var attachment = bytes.Repeat([]byte("0123456789"), 1000)
+
+/* uploadAttachment uploads attachment to srv, returning its download URL. */
+func uploadAttachment(t *testing.T, yc *ynote.YnoteClient) string {
+	t.Helper()
+	ai, err := yc.UploadAttachmentReader(context.Background(), "a.bin",
+		bytes.NewReader(attachment), int64(len(attachment)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ai.URL
+}
+
+func TestDownloadAttachment(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	yc := srv.Client()
+	link := uploadAttachment(t, yc)
+
+	var buf bytes.Buffer
+	n, err := yc.DownloadAttachment(context.Background(), link, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(attachment)) || !bytes.Equal(buf.Bytes(), attachment) {
+		t.Errorf("downloaded %d bytes", n)
+	}
+
+	buf.Reset()
+	_, err = yc.DownloadAttachment(context.Background(), link+"x", &buf)
+	if !errors.Is(err, ynote.ErrNotFound) {
+		t.Errorf("DownloadAttachment of a missing resource: %v, want ErrNotFound", err)
+	}
+}
+
+func TestDownloadAttachmentFrom(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	yc := srv.Client()
+	link := uploadAttachment(t, yc)
+
+	for _, offset := range []int64{1, 5000, int64(len(attachment)) - 1, int64(len(attachment))} {
+		var buf bytes.Buffer
+		n, err := yc.DownloadAttachmentFrom(context.Background(), link, &buf, offset)
+		if err != nil {
+			t.Errorf("offset %d: %v", offset, err)
+			continue
+		}
+		if n != int64(len(attachment))-offset || !bytes.Equal(buf.Bytes(), attachment[offset:]) {
+			t.Errorf("offset %d: downloaded %d bytes", offset, n)
+		}
+	}
+}
+
+/* truncateOnce cuts the body of the first response after limit bytes. */
+func truncateOnce(limit int64) ynote.Middleware {
+	done := false
+	return func(next http.RoundTripper) http.RoundTripper {
+		return ynote.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			res, err := next.RoundTrip(req)
+			if err != nil || done {
+				return res, err
+			}
+			done = true
+			res.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.LimitReader(res.Body, limit), res.Body}
+			return res, nil
+		})
+	}
+}
+
+func TestDownloadAttachmentResume(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	link := uploadAttachment(t, srv.Client())
+
+	var ranges []string
+	recordRanges := func(next http.RoundTripper) http.RoundTripper {
+		return ynote.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			ranges = append(ranges, req.Header.Get("Range"))
+			return next.RoundTrip(req)
+		})
+	}
+	yc := srv.Client(ynote.WithRetryPolicy(fastRetries),
+		ynote.WithMiddleware(recordRanges, truncateOnce(3000)))
+
+	var buf bytes.Buffer
+	n, err := yc.DownloadAttachment(context.Background(), link, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(attachment)) || !bytes.Equal(buf.Bytes(), attachment) {
+		t.Errorf("downloaded %d bytes", n)
+	}
+	if len(ranges) != 2 || ranges[0] != "" || ranges[1] != "bytes=3000-" {
+		t.Errorf("Range headers: %q", ranges)
+	}
+
+	// Without retrying, the interruption is returned.
+	yc = srv.Client(ynote.WithMiddleware(truncateOnce(3000)))
+	buf.Reset()
+	n, err = yc.DownloadAttachment(context.Background(), link, &buf)
+	if err != io.ErrUnexpectedEOF || n != 3000 {
+		t.Errorf("DownloadAttachment: %d, %v; want 3000, io.ErrUnexpectedEOF", n, err)
+	}
+}
@@ -0,0 +1,218 @@
+/*
+	Package enex imports notes exported from Evernote as ENEX files, and
+	exports notebooks as ENEX files for Evernote and other tools.
+
+		f, err := os.Open("Evernote.enex")
+		...
+		imported, err := enex.Import(ctx, yc, f, "Evernote", "")
+		...
+		fmt.Println(len(imported.Notes), "notes imported")
+
+	An ENEX file is an XML document with the notes, whose contents are in
+	ENML, an XHTML dialect, and whose resources, i.e. images and attachments,
+	are embedded in base64. The resources are uploaded, and the <en-media>
+	elements referring to them by the MD5 hashes of their data are replaced
+	with images or attachments of the uploaded files. Check boxes, i.e.
+	<en-todo>, become ☑ and ☐ characters.
+
+	The title, author and source URL are kept. Tags and the creation and
+	modification times are not, since the open API does not support them.
+
+	Export does the reverse, embedding the images and attachments of the
+	notes, and keeping the creation and modification times:
+
+		f, err := os.Create("Work.enex")
+		...
+		err = enex.Export(ctx, yc, nbi, f)
+*/
+package enex
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"time"
+)
+
+/* Note is a note in an ENEX file. */
+type Note struct {
+	Title string `xml:"title"`
+	// The ENML content
+	Content    string         `xml:"content"`
+	Created    Time           `xml:"created"`
+	Updated    Time           `xml:"updated"`
+	Tags       []string       `xml:"tag"`
+	Attributes NoteAttributes `xml:"note-attributes"`
+	Resources  []*Resource    `xml:"resource"`
+}
+
+/*
+	MarshalXML encodes n as a <note>, with the content in a CDATA section as
+	usual, and the elements in the order of the DTD.
+*/
+func (n *Note) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement(struct {
+		Title      string         `xml:"title"`
+		Content    cdata          `xml:"content"`
+		Created    Time           `xml:"created"`
+		Updated    Time           `xml:"updated"`
+		Tags       []string       `xml:"tag"`
+		Attributes NoteAttributes `xml:"note-attributes"`
+		Resources  []*Resource    `xml:"resource"`
+	}{n.Title, cdata{n.Content}, n.Created, n.Updated, n.Tags, n.Attributes,
+		n.Resources}, xml.StartElement{Name: xml.Name{Local: "note"}})
+}
+
+type cdata struct {
+	Text string `xml:",cdata"`
+}
+
+/* NoteAttributes are the attributes of a Note used here. */
+type NoteAttributes struct {
+	Author    string `xml:"author,omitempty"`
+	Source    string `xml:"source,omitempty"`
+	SourceURL string `xml:"source-url,omitempty"`
+}
+
+/* Resource is an image or attachment of a Note. */
+type Resource struct {
+	Data Data `xml:"data"`
+	// The MIME type, e.g. image/png
+	Mime       string             `xml:"mime"`
+	Width      int                `xml:"width,omitempty"`
+	Height     int                `xml:"height,omitempty"`
+	Attributes ResourceAttributes `xml:"resource-attributes"`
+}
+
+/* Data is the encoded data of a Resource. */
+type Data struct {
+	// Always base64
+	Encoding string `xml:"encoding,attr"`
+	Content  string `xml:",chardata"`
+}
+
+/* ResourceAttributes are the attributes of a Resource used here. */
+type ResourceAttributes struct {
+	SourceURL string `xml:"source-url,omitempty"`
+	FileName  string `xml:"file-name,omitempty"`
+}
+
+/* Bytes returns the decoded data of res. */
+func (res *Resource) Bytes() ([]byte, error) {
+	// The data is wrapped in lines.
+	return base64.StdEncoding.DecodeString(strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, res.Data.Content))
+}
+
+/*
+	FileName returns the file name of res, adding an extension by the MIME
+	type if it has none, or a name by the MIME type if it has none.
+*/
+func (res *Resource) FileName() string {
+	name := path.Base(strings.Replace(res.Attributes.FileName, "\\", "/", -1))
+	if name == "." || name == "/" {
+		name = ""
+	}
+	if path.Ext(name) != "" {
+		return name
+	}
+	if name == "" {
+		name = "resource"
+		if i := strings.Index(res.Mime, "/"); i > 0 {
+			name = res.Mime[:i]
+		}
+	}
+	if ext, ok := extensions[res.Mime]; ok {
+		name += ext
+	} else if exts, _ := mime.ExtensionsByType(res.Mime); len(exts) > 0 {
+		name += exts[0]
+	}
+	return name
+}
+
+/*
+	The extensions of common MIME types, where mime.ExtensionsByType returns
+	several in an unhelpful order
+*/
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"audio/mpeg": ".mp3",
+	"text/plain": ".txt",
+}
+
+/* hashOf returns the hash of data referenced by <en-media>. */
+func hashOf(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+/* The layout of times in ENEX files */
+const TimeLayout = "20060102T150405Z"
+
+/* Time is a time in an ENEX file, in UTC. */
+type Time struct {
+	time.Time
+}
+
+/* MarshalText formats t in TimeLayout, or as empty if it is zero. */
+func (t Time) MarshalText() ([]byte, error) {
+	if t.IsZero() {
+		return nil, nil
+	}
+	return []byte(t.UTC().Format(TimeLayout)), nil
+}
+
+/* UnmarshalText parses text in TimeLayout, or an empty text as zero. */
+func (t *Time) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		t.Time = time.Time{}
+		return nil
+	}
+	tm, err := time.Parse(TimeLayout, string(text))
+	if err != nil {
+		return err
+	}
+	t.Time = tm
+	return nil
+}
+
+/* Reader reads the notes of an ENEX file one by one. */
+type Reader struct {
+	d *xml.Decoder
+}
+
+/* NewReader returns a Reader reading r. */
+func NewReader(r io.Reader) *Reader {
+	d := xml.NewDecoder(r)
+	// The DOCTYPE refers to the entities of the DTD.
+	d.Entity = xml.HTMLEntity
+	return &Reader{d: d}
+}
+
+/* Next returns the next note, or io.EOF if there is none. */
+func (r *Reader) Next() (*Note, error) {
+	for {
+		tok, err := r.d.Token()
+		if err != nil {
+			return nil, err
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Local == "note" {
+			var n Note
+			if err := r.d.DecodeElement(&n, &se); err != nil {
+				return nil, err
+			}
+			return &n, nil
+		}
+	}
+}
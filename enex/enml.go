@@ -0,0 +1,305 @@
+package enex
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/youdao-api/go-ynote/notecontent"
+)
+
+/* The void elements allowed in ENML */
+var voidElements = map[atom.Atom]bool{
+	atom.Area: true, atom.Br: true, atom.Col: true, atom.Hr: true,
+	atom.Img: true,
+}
+
+/*
+	toHTML converts ENML to note HTML. media returns the inline replacing an
+	<en-media> element with the attributes, or nil to drop it.
+
+	ENML is XML, so <en-media/> is self-closing, which HTML parsers ignore for
+	unknown elements. Tokens are therefore converted one by one.
+*/
+func toHTML(enml string, media func(attr []html.Attribute) notecontent.Inline) string {
+	var sb strings.Builder
+	z := html.NewTokenizer(strings.NewReader(enml))
+	// Whether in <en-note>, outside of which only whitespace is expected
+	inNote := false
+	// The depth in an <en-crypt>, whose text is dropped
+	crypt := 0
+	for {
+		if z.Next() == html.ErrorToken {
+			// Only io.EOF, reading a string
+			break
+		}
+		tok := z.Token()
+		switch tok.Type {
+		case html.DoctypeToken, html.CommentToken:
+			// The DOCTYPE, and <?xml ...?> as a bogus comment
+			continue
+		case html.TextToken:
+			if inNote && crypt == 0 {
+				sb.WriteString(tok.String())
+			}
+			continue
+		}
+
+		start := tok.Type == html.StartTagToken || tok.Type == html.SelfClosingTagToken
+		switch tok.Data {
+		case "en-note":
+			inNote = start
+		case "en-media":
+			if start && crypt == 0 {
+				if in := media(tok.Attr); in != nil {
+					renderInline(&sb, in)
+				}
+			}
+		case "en-todo":
+			if start && crypt == 0 {
+				if checked, _ := getAttr(tok.Attr, "checked"); checked == "true" {
+					sb.WriteString("☑ ")
+				} else {
+					sb.WriteString("☐ ")
+				}
+			}
+		case "en-crypt":
+			switch tok.Type {
+			case html.StartTagToken:
+				if crypt == 0 {
+					renderInline(&sb, &notecontent.Text{Text: "[Encrypted content]"})
+				}
+				crypt++
+			case html.EndTagToken:
+				if crypt > 0 {
+					crypt--
+				}
+			}
+		default:
+			if !inNote || crypt > 0 {
+				continue
+			}
+			if tok.Type == html.SelfClosingTagToken {
+				// <div/> is a start tag in HTML.
+				tok.Type = html.StartTagToken
+				sb.WriteString(tok.String())
+				if !voidElements[tok.DataAtom] {
+					sb.WriteString("</" + tok.Data + ">")
+				}
+				continue
+			}
+			sb.WriteString(tok.String())
+		}
+	}
+	return sb.String()
+}
+
+func renderInline(sb *strings.Builder, in notecontent.Inline) {
+	doc := &notecontent.Document{Blocks: []notecontent.Block{
+		&notecontent.Paragraph{Inlines: []notecontent.Inline{in}},
+	}}
+	sb.WriteString(doc.Render())
+}
+
+/*
+	mediaAttr returns the attributes of an image kept between an <img> and
+	an <en-media>.
+*/
+func mediaAttr(attr []html.Attribute) []html.Attribute {
+	var res []html.Attribute
+	for _, a := range attr {
+		switch a.Key {
+		case "alt", "width", "height", "style", "align", "title":
+			res = append(res, a)
+		}
+	}
+	return res
+}
+
+/* The XHTML elements allowed in ENML */
+var enmlElements = map[atom.Atom]bool{
+	atom.A: true, atom.Abbr: true, atom.Acronym: true, atom.Address: true,
+	atom.Area: true, atom.B: true, atom.Bdo: true, atom.Big: true,
+	atom.Blockquote: true, atom.Br: true, atom.Caption: true,
+	atom.Center: true, atom.Cite: true, atom.Code: true, atom.Col: true,
+	atom.Colgroup: true, atom.Dd: true, atom.Del: true, atom.Dfn: true,
+	atom.Div: true, atom.Dl: true, atom.Dt: true, atom.Em: true,
+	atom.Font: true, atom.H1: true, atom.H2: true, atom.H3: true,
+	atom.H4: true, atom.H5: true, atom.H6: true, atom.Hr: true,
+	atom.I: true, atom.Img: true, atom.Ins: true, atom.Kbd: true,
+	atom.Li: true, atom.Map: true, atom.Ol: true, atom.P: true,
+	atom.Pre: true, atom.Q: true, atom.S: true, atom.Samp: true,
+	atom.Small: true, atom.Span: true, atom.Strike: true, atom.Strong: true,
+	atom.Sub: true, atom.Sup: true, atom.Table: true, atom.Tbody: true,
+	atom.Td: true, atom.Tfoot: true, atom.Th: true, atom.Thead: true,
+	atom.Tr: true, atom.Tt: true, atom.U: true, atom.Ul: true,
+	atom.Var: true, atom.Xmp: true,
+}
+
+/* Elements dropped with their content, other unknown ones are unwrapped */
+var droppedElements = map[atom.Atom]bool{
+	atom.Applet: true, atom.Base: true, atom.Button: true, atom.Embed: true,
+	atom.Frame: true, atom.Frameset: true, atom.Head: true, atom.Iframe: true,
+	atom.Input: true, atom.Link: true, atom.Meta: true, atom.Noframes: true,
+	atom.Noscript: true, atom.Object: true, atom.Param: true,
+	atom.Script: true, atom.Select: true, atom.Style: true,
+	atom.Template: true, atom.Textarea: true, atom.Title: true,
+}
+
+/* Unknown block elements written as <div>s */
+var blockElements = map[atom.Atom]bool{
+	atom.Article: true, atom.Aside: true, atom.Details: true,
+	atom.Fieldset: true, atom.Figcaption: true, atom.Figure: true,
+	atom.Footer: true, atom.Form: true, atom.Header: true, atom.Main: true,
+	atom.Nav: true, atom.Section: true, atom.Summary: true,
+}
+
+/* Attributes not allowed in ENML, besides event handlers */
+var droppedAttributes = map[string]bool{
+	"id": true, "class": true, "accesskey": true, "data": true,
+	"dynsrc": true, "tabindex": true,
+}
+
+/* The document type of ENML */
+const enmlDoctype = `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+	`<!DOCTYPE en-note SYSTEM "http://xml.evernote.com/pub/enml2.dtd">` + "\n"
+
+/*
+	toENML converts note HTML to an ENML document. media returns the
+	<en-media> attributes replacing an image or attachment, i.e. an <img>,
+	or nil to keep it as an <img>, or drop it for an attachment.
+*/
+func toENML(content string, media func(img *html.Node) []html.Attribute) string {
+	var sb strings.Builder
+	sb.WriteString(enmlDoctype + "<en-note>")
+
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, _ := html.ParseFragment(strings.NewReader(content), body)
+	for _, n := range nodes {
+		writeENML(&sb, n, media)
+	}
+
+	sb.WriteString("</en-note>")
+	return sb.String()
+}
+
+func writeENML(sb *strings.Builder, n *html.Node, media func(img *html.Node) []html.Attribute) {
+	switch n.Type {
+	case html.TextNode:
+		writeENMLText(sb, n.Data)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	tag := n.Data
+	switch {
+	case n.DataAtom == atom.Img:
+		if attr := media(n); attr != nil {
+			writeStartTag(sb, "en-media", attr, true)
+			return
+		}
+		if _, ok := getAttr(n.Attr, "path"); ok {
+			// An attachment not embedded
+			return
+		}
+	case droppedElements[n.DataAtom]:
+		return
+	case blockElements[n.DataAtom]:
+		tag = "div"
+	case !enmlElements[n.DataAtom]:
+		tag = ""
+	}
+
+	void := voidElements[n.DataAtom]
+	if tag != "" {
+		writeStartTag(sb, tag, enmlAttr(n.Attr), void)
+	}
+	if void {
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeENML(sb, c, media)
+	}
+	if tag != "" {
+		sb.WriteString("</" + tag + ">")
+	}
+}
+
+/* enmlAttr returns the attributes of attr allowed in ENML. */
+func enmlAttr(attr []html.Attribute) []html.Attribute {
+	var res []html.Attribute
+	for _, a := range attr {
+		if a.Namespace != "" || droppedAttributes[a.Key] ||
+			strings.HasPrefix(a.Key, "on") || a.Key == "path" ||
+			!isXMLName(a.Key) {
+			continue
+		}
+		res = append(res, html.Attribute{Key: a.Key, Val: a.Val})
+	}
+	return res
+}
+
+func isXMLName(s string) bool {
+	for i, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_' ||
+			i > 0 && (r >= '0' && r <= '9' || r == '-' || r == '.')) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func writeStartTag(sb *strings.Builder, tag string, attr []html.Attribute, selfClosing bool) {
+	sb.WriteString("<" + tag)
+	for _, a := range attr {
+		sb.WriteString(" " + a.Key + `="` + escapeXML(a.Val) + `"`)
+	}
+	if selfClosing {
+		sb.WriteString("/>")
+	} else {
+		sb.WriteString(">")
+	}
+}
+
+/* writeENMLText writes text, with ☑ and ☐ as check boxes, i.e. <en-todo>. */
+func writeENMLText(sb *strings.Builder, text string) {
+	for {
+		i := strings.IndexAny(text, "☑☐")
+		if i < 0 {
+			break
+		}
+		sb.WriteString(escapeXML(text[:i]))
+		if strings.HasPrefix(text[i:], "☑") {
+			sb.WriteString(`<en-todo checked="true"/>`)
+		} else {
+			sb.WriteString(`<en-todo/>`)
+		}
+		// Both are 3 bytes in UTF-8. The space after them is added back by
+		// toHTML.
+		text = strings.TrimPrefix(text[i+3:], " ")
+	}
+	sb.WriteString(escapeXML(text))
+}
+
+/* escapeXML escapes s, dropping characters not allowed in XML. */
+func escapeXML(s string) string {
+	return html.EscapeString(strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' ||
+			r == 0xFFFE || r == 0xFFFF {
+			return -1
+		}
+		return r
+	}, s))
+}
+
+func getAttr(attr []html.Attribute, key string) (string, bool) {
+	for _, a := range attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,156 @@
+package enex
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+
+	ynote "github.com/youdao-api/go-ynote"
+)
+
+/* The application written to exported ENEX files */
+const Application = "go-ynote"
+
+/* The header of an ENEX file, with the export date and application */
+const exportHeader = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE en-export SYSTEM "http://xml.evernote.com/pub/evernote-export3.dtd">
+<en-export export-date="%s" application="%s" version="1.0">
+`
+
+/*
+	Export writes an ENEX file of all notes of the notebook nbi to w. The
+	notes are fetched and written one by one.
+*/
+func Export(ctx context.Context, s ynote.NoteService, nbi *ynote.NotebookInfo, w io.Writer) error {
+	paths, err := s.ListNotesContext(ctx, nbi.Path)
+	if err != nil {
+		return err
+	}
+
+	date, _ := Time{time.Now()}.MarshalText()
+	if _, err := fmt.Fprintf(w, exportHeader, date, Application); err != nil {
+		return err
+	}
+	e := xml.NewEncoder(w)
+	for _, p := range paths {
+		ni, err := s.NoteInfoContext(ctx, p)
+		if err != nil {
+			return err
+		}
+		n, err := ExportNote(ctx, s, ni)
+		if err != nil {
+			return fmt.Errorf("enex: export %q: %w", ni.Title, err)
+		}
+		if err := e.Encode(n); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	_, err = io.WriteString(w, "</en-export>\n")
+	return err
+}
+
+/*
+	ExportNote converts ni to a Note with the content in ENML. Images and
+	attachments uploaded to the service are downloaded via s and embedded as
+	resources, referred to by <en-media> elements. Images linked from other
+	sites are kept as <img> elements; attachments not found are dropped.
+*/
+func ExportNote(ctx context.Context, s ynote.NoteService, ni *ynote.NoteInfo) (*Note, error) {
+	n := &Note{
+		Title:   ni.Title,
+		Created: Time{ni.CreateTime},
+		Updated: Time{ni.ModifyTime},
+		Attributes: NoteAttributes{
+			Author:    ni.Author,
+			SourceURL: ni.Source,
+		},
+	}
+
+	// The en-media attributes of the downloaded resources by URL, nil for
+	// resources not found
+	media := make(map[string][]html.Attribute)
+	// Resources of the same content are embedded once.
+	embedded := make(map[string]bool)
+	var err error
+	n.Content = toENML(ni.Content, func(img *html.Node) []html.Attribute {
+		u, ok := getAttr(img.Attr, "path")
+		if !ok {
+			u, _ = getAttr(img.Attr, "src")
+		}
+		// Only resources stored by the service, not e.g. images linked from
+		// other sites, which would get the access token in the signature.
+		if err != nil || !strings.Contains(u, "/yws/") {
+			return nil
+		}
+		attr, ok := media[u]
+		if !ok {
+			var res *Resource
+			var hash string
+			res, hash, err = downloadResource(ctx, s, u)
+			if err != nil {
+				return nil
+			}
+			if res != nil {
+				if !embedded[hash] {
+					embedded[hash] = true
+					n.Resources = append(n.Resources, res)
+				}
+				attr = []html.Attribute{
+					{Key: "hash", Val: hash},
+					{Key: "type", Val: res.Mime},
+				}
+			}
+			media[u] = attr
+		}
+		if attr == nil {
+			return nil
+		}
+		return append(append([]html.Attribute(nil), attr...), mediaAttr(img.Attr)...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+/*
+	downloadResource downloads the resource of URL u, returning it with the
+	hash of its data, or nil if it is not found.
+*/
+func downloadResource(ctx context.Context, s ynote.NoteService, u string) (*Resource, string, error) {
+	var buf bytes.Buffer
+	if _, err := s.DownloadAttachment(ctx, u, &buf); err != nil {
+		if errors.Is(err, ynote.ErrNotFound) {
+			return nil, "", nil
+		}
+		return nil, "", fmt.Errorf("download %s: %w", u, err)
+	}
+
+	name := path.Base(strings.SplitN(u, "?", 2)[0])
+	typ, _, _ := mime.ParseMediaType(mime.TypeByExtension(path.Ext(name)))
+	if typ == "" {
+		typ, _, _ = mime.ParseMediaType(http.DetectContentType(buf.Bytes()))
+	}
+	return &Resource{
+		Data: Data{
+			Encoding: "base64",
+			Content:  base64.StdEncoding.EncodeToString(buf.Bytes()),
+		},
+		Mime:       typ,
+		Attributes: ResourceAttributes{FileName: name},
+	}, hashOf(buf.Bytes()), nil
+}
@@ -0,0 +1,91 @@
+package enex
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	ynote "github.com/youdao-api/go-ynote"
+	"github.com/youdao-api/go-ynote/ynotetest"
+)
+
+func uploadData(t *testing.T, yc *ynote.YnoteClient, name string, data []byte) *ynote.AttachInfo {
+	t.Helper()
+	ai, err := yc.UploadAttachmentReader(context.Background(), name,
+		bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ai
+}
+
+func TestExport(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	yc := srv.Client()
+
+	img := uploadData(t, yc, "a.png", pngData)
+	img2 := uploadData(t, yc, "a.png", pngData)
+	pdf := uploadData(t, yc, "r.pdf", []byte("%PDF-1.4 x ]]> y"))
+	nb, err := yc.CreateNotebook("Work", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := `<p id="x" class="c" onclick="y">☑ done ☐ todo &amp; ]]&gt;</p>` +
+		`<section>sec</section><script>bad()</script><form><label>l</label></form>` +
+		`<p><img src="` + img.URL + `" width="10" class="q"><img src="` + img2.URL + `">` +
+		`<img src="http://e.com/x.png"><img path="` + pdf.URL + `" src="` + pdf.Src + `">` +
+		`<img path="` + srv.URL + `/yws/open/resource/download/missing.pdf" src="x"><br></p>` +
+		`<table><tr><td>c</td></tr></table>`
+	if _, err := yc.CreateNote(nb.Path, "T <1>", "me", "http://s/", content); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := yc.CreateNote(nb.Path, "Empty", "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Export(context.Background(), yc, nb, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReader(bytes.NewReader(buf.Bytes()))
+	n, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The same image uploaded twice is one resource.
+	if n.Title != "T <1>" || n.Created.IsZero() || n.Attributes.Author != "me" ||
+		n.Attributes.SourceURL != "http://s/" || len(n.Resources) != 2 {
+		t.Errorf("exported %+v", n)
+	}
+	for _, invalid := range []string{"id=", "class=", "onclick", "bad()", "<section", "<form", "<label", "path="} {
+		if strings.Contains(n.Content, invalid) {
+			t.Errorf("%s in ENML %s", invalid, n.Content)
+		}
+	}
+	if !strings.Contains(n.Content, "<en-media") {
+		t.Errorf("no en-media in ENML %s", n.Content)
+	}
+	if n, err := r.Next(); err != nil || n.Title != "Empty" {
+		t.Fatalf("second note: %+v, %v", n, err)
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("Next after the last note: %v, want io.EOF", err)
+	}
+
+	// Imported back
+	srv2 := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv2.Close()
+	imp, err := Import(context.Background(), srv2.Client(), bytes.NewReader(buf.Bytes()), "Work", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ni := srv2.Note(imp.Notes[0])
+	if !strings.Contains(ni.Content, "☑ done ☐ todo &amp; ]]&gt;") || imp.Resources != 2 ||
+		strings.Count(ni.Content, "<img") != 4 {
+		t.Errorf("imported %+v: %s", imp, ni.Content)
+	}
+}
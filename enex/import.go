@@ -0,0 +1,138 @@
+package enex
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	ynote "github.com/youdao-api/go-ynote"
+	"github.com/youdao-api/go-ynote/notecontent"
+)
+
+/* Imported is what Import created. */
+type Imported struct {
+	// The path of the notebook
+	Notebook string
+	// The paths of the notes, in the order in the file
+	Notes []string
+	// The number of resources uploaded
+	Resources int
+}
+
+/*
+	Import creates a notebook of name in group via s, and imports all notes
+	of the ENEX file read from r into it. On an error, what is imported so
+	far is returned with it.
+*/
+func Import(ctx context.Context, s ynote.NoteService, r io.Reader, name, group string) (*Imported, error) {
+	nbi, err := s.CreateNotebookContext(ctx, name, group)
+	if err != nil {
+		return nil, err
+	}
+
+	imported := &Imported{Notebook: nbi.Path}
+	er := NewReader(r)
+	for {
+		n, err := er.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return imported, fmt.Errorf("enex: %w", err)
+		}
+
+		p, resources, err := importNote(ctx, s, nbi.Path, n)
+		imported.Resources += resources
+		if err != nil {
+			return imported, fmt.Errorf("enex: import %q: %w", n.Title, err)
+		}
+		imported.Notes = append(imported.Notes, p)
+	}
+	return imported, nil
+}
+
+/*
+	ImportNote uploads the resources of n and creates it in the notebook via
+	s, returning the path of the note.
+*/
+func ImportNote(ctx context.Context, s ynote.NoteService, notebook string, n *Note) (string, error) {
+	p, _, err := importNote(ctx, s, notebook, n)
+	return p, err
+}
+
+func importNote(ctx context.Context, s ynote.NoteService, notebook string, n *Note) (string, int, error) {
+	// The uploaded resources by hash, in the order in n
+	uploaded := make(map[string]*ynote.AttachInfo)
+	var hashes []string
+	for _, res := range n.Resources {
+		data, err := res.Bytes()
+		if err != nil {
+			return "", len(hashes), fmt.Errorf("resource %s: %w", res.FileName(), err)
+		}
+		hash := hashOf(data)
+		if _, ok := uploaded[hash]; ok {
+			continue
+		}
+		ai, err := s.UploadAttachmentReader(ctx, res.FileName(),
+			bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return "", len(hashes), err
+		}
+		uploaded[hash] = ai
+		hashes = append(hashes, hash)
+	}
+
+	referenced := make(map[string]bool)
+	content := toHTML(n.Content, func(attr []html.Attribute) notecontent.Inline {
+		hash, _ := getAttr(attr, "hash")
+		hash = strings.ToLower(hash)
+		ai, ok := uploaded[hash]
+		if !ok {
+			return nil
+		}
+		referenced[hash] = true
+		return mediaInline(ai, attr)
+	})
+
+	// Resources not referenced by the content are appended to it, so none
+	// is lost.
+	var rest []notecontent.Inline
+	for _, hash := range hashes {
+		if !referenced[hash] {
+			rest = append(rest, notecontent.FromAttachInfo(uploaded[hash]))
+		}
+	}
+	if len(rest) > 0 {
+		content += (&notecontent.Document{Blocks: []notecontent.Block{
+			notecontent.NewParagraph(rest...),
+		}}).Render()
+	}
+
+	p, err := s.CreateNoteContext(ctx, notebook, n.Title, n.Attributes.Author,
+		n.Attributes.SourceURL, content)
+	return p, len(hashes), err
+}
+
+/*
+	mediaInline returns the inline of an uploaded resource for an <en-media>,
+	keeping the size and style of an image.
+*/
+func mediaInline(ai *ynote.AttachInfo, attr []html.Attribute) notecontent.Inline {
+	in := notecontent.FromAttachInfo(ai)
+	img, ok := in.(*notecontent.Image)
+	if !ok {
+		return in
+	}
+	for _, a := range mediaAttr(attr) {
+		if a.Key == "alt" {
+			img.Alt = a.Val
+		} else {
+			img.Attr = append(img.Attr, a)
+		}
+	}
+	return img
+}
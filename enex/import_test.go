@@ -0,0 +1,113 @@
+package enex
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/youdao-api/go-ynote/ynotetest"
+)
+
+var (
+	pngData = []byte("\x89PNG\r\n\x1a\n0000")
+	pdfData = []byte("%PDF-1.4 xyz")
+)
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+/* base64Data returns data in base64, broken into lines as Evernote does. */
+func base64Data(data []byte) string {
+	s := base64.StdEncoding.EncodeToString(data)
+	return s[:4] + "\n  " + s[4:]
+}
+
+var enexData = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE en-export SYSTEM "http://xml.evernote.com/pub/evernote-export3.dtd">
+<en-export export-date="20240101T000000Z" application="Evernote" version="10">
+<note><title>First &amp; one</title><content><![CDATA[<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE en-note SYSTEM "http://xml.evernote.com/pub/enml2.dtd">
+<en-note><div>Hello&nbsp;<b>world</b> &lt;x&gt;</div>` +
+	`<div><en-todo checked="true"/>done <en-todo/>todo</div>` +
+	`<div><en-media hash="` + md5Hex(pngData) + `" type="image/png" width="100"/></div>` +
+	`<en-media hash="` + md5Hex(pdfData) + `" type="application/pdf"></en-media>` +
+	`<div/><br/><en-crypt hint="pw">SECRET</en-crypt></en-note>]]></content>
+<created>20230102T030405Z</created><updated>20230203T040506Z</updated><tag>a</tag>
+<note-attributes><author>Ann</author><source-url>https://example.com/</source-url></note-attributes>
+<resource><data encoding="base64">` + base64Data(pngData) + `</data><mime>image/png</mime><width>100</width>` +
+	`<resource-attributes><file-name>pic</file-name></resource-attributes></resource>
+<resource><data encoding="base64">` + base64Data(pdfData) + `</data><mime>application/pdf</mime>` +
+	`<resource-attributes><file-name>doc.pdf</file-name></resource-attributes></resource>
+<resource><data encoding="base64">` + base64Data([]byte("GIF89a....")) + `</data><mime>image/gif</mime></resource>
+</note>
+<note><title>Second</title><content><![CDATA[<en-note>plain</en-note>]]></content></note>
+</en-export>`
+
+func TestReader(t *testing.T) {
+	r := NewReader(strings.NewReader(enexData))
+	n, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Title != "First & one" || n.Created.Year() != 2023 || n.Updated.Month() != 2 ||
+		len(n.Tags) != 1 || n.Attributes.Author != "Ann" || len(n.Resources) != 3 {
+		t.Errorf("first note: %+v", n)
+	}
+	for i, want := range []string{"pic.png", "doc.pdf", "image.gif"} {
+		if got := n.Resources[i].FileName(); got != want {
+			t.Errorf("resource %d: FileName %q, want %q", i, got, want)
+		}
+	}
+	if data, err := n.Resources[0].Bytes(); err != nil || string(data) != string(pngData) {
+		t.Errorf("Bytes: %q, %v", data, err)
+	}
+
+	if n, err := r.Next(); err != nil || n.Title != "Second" {
+		t.Fatalf("second note: %+v, %v", n, err)
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("Next after the last note: %v, want io.EOF", err)
+	}
+}
+
+func TestImport(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	yc := srv.Client()
+
+	imp, err := Import(context.Background(), yc, strings.NewReader(enexData), "Evernote", "G")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imp.Notes) != 2 || imp.Resources != 3 {
+		t.Fatalf("imported %+v", imp)
+	}
+
+	ni := srv.Note(imp.Notes[0])
+	if ni.Title != "First & one" || ni.Author != "Ann" || ni.Source != "https://example.com/" {
+		t.Errorf("first note: %+v", ni)
+	}
+	for _, want := range []string{
+		"Hello\u00a0<b>world</b> &lt;x&gt;", "☑ done ☐ todo", `width="100"`, `path="`,
+		"[Encrypted content]", "<div></div>", "<br>",
+	} {
+		if !strings.Contains(ni.Content, want) {
+			t.Errorf("%s not in %s", want, ni.Content)
+		}
+	}
+	for _, leaked := range []string{"SECRET", "en-", "<?xml"} {
+		if strings.Contains(ni.Content, leaked) {
+			t.Errorf("%s in %s", leaked, ni.Content)
+		}
+	}
+
+	if ni := srv.Note(imp.Notes[1]); ni.Content != "plain" {
+		t.Errorf("second note: %q", ni.Content)
+	}
+}
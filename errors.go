@@ -0,0 +1,203 @@
+package ynote
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+/*
+	Sentinel errors classifying failures reported by the service. Use
+	errors.Is to test a returned error against them, and errors.As with a
+	*FailInfo to get the details, e.g.
+
+		if errors.Is(err, ynote.ErrTokenExpired) {
+			// authorize again
+		}
+
+	A failure is classified by its error code if it is one of the Code*
+	constants, otherwise by the HTTP status of the response.
+*/
+var (
+	// The access token is expired, revoked or invalid: CodeTokenExpired, or
+	// status 401.
+	ErrTokenExpired = errors.New("ynote: access token expired or invalid")
+	// The access token does not allow the operation: status 403.
+	ErrPermissionDenied = errors.New("ynote: permission denied")
+	// The notebook, note or resource does not exist: CodeNotFound, or status
+	// 404.
+	ErrNotFound = errors.New("ynote: not found")
+	// The space of the user is exhausted: CodeQuotaExceeded, or status 413 or
+	// 507. Such failures are never retried.
+	ErrQuotaExceeded = errors.New("ynote: quota exceeded")
+	// A parameter of the call is missing or invalid: CodeBadParameter, or
+	// status 400.
+	ErrBadParameter = errors.New("ynote: bad parameter")
+	// The service rejected the call for too many requests: status 429. Such
+	// failures are retried as set by the RetryPolicy. Unlike ErrRateLimited,
+	// it is reported by the service.
+	ErrTooManyRequests = errors.New("ynote: too many requests")
+)
+
+/*
+	ErrorCode is an error code reported by the service in FailInfo.Err. The
+	service reports failures with status 500 and the code in the JSON body.
+	The constants are the codes of the error code list of the open API
+	documentation which are classified by a sentinel error; ynotetest reports
+	the same codes.
+*/
+type ErrorCode string
+
+const (
+	// A parameter is missing or invalid.
+	CodeBadParameter ErrorCode = "1002"
+	// The access token is expired or invalid.
+	CodeTokenExpired ErrorCode = "1007"
+	// The notebook, note or resource does not exist.
+	CodeNotFound ErrorCode = "1013"
+	// The space of the user is exhausted.
+	CodeQuotaExceeded ErrorCode = "1017"
+)
+
+/*
+	errorCodes maps error codes reported by the service to the sentinel errors
+	a *FailInfo with the code matches. Codes not in the map are classified by
+	the HTTP status of the response.
+*/
+var errorCodes = map[ErrorCode]error{
+	CodeBadParameter:  ErrBadParameter,
+	CodeTokenExpired:  ErrTokenExpired,
+	CodeNotFound:      ErrNotFound,
+	CodeQuotaExceeded: ErrQuotaExceeded,
+}
+
+/* The information for a failure calling. It is returned as an error. */
+type FailInfo struct {
+	Message string
+	Err     string
+	// The HTTP status code of the response
+	StatusCode int
+	// The raw body of the response, for diagnostics
+	Body []byte
+	// The delay suggested by the Retry-After header, zero if absent
+	RetryAfter time.Duration
+}
+
+/* Implementation of error.Error  */
+func (info *FailInfo) Error() string {
+	return fmt.Sprintf("%s: %s", info.Err, info.Message)
+}
+
+/* Code returns the error code reported by the service. */
+func (info *FailInfo) Code() ErrorCode {
+	return ErrorCode(info.Err)
+}
+
+/*
+	Kind returns the sentinel error classifying the failure, or nil if it is
+	not known.
+*/
+func (info *FailInfo) Kind() error {
+	if kind, ok := errorCodes[info.Code()]; ok {
+		return kind
+	}
+
+	switch info.StatusCode {
+	case http.StatusUnauthorized:
+		return ErrTokenExpired
+	case http.StatusForbidden:
+		return ErrPermissionDenied
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusBadRequest:
+		return ErrBadParameter
+	case http.StatusRequestEntityTooLarge, http.StatusInsufficientStorage:
+		return ErrQuotaExceeded
+	case http.StatusTooManyRequests:
+		return ErrTooManyRequests
+	}
+	return nil
+}
+
+/* Is reports whether target is the sentinel error returned by Kind. */
+func (info *FailInfo) Is(target error) bool {
+	kind := info.Kind()
+	return kind != nil && kind == target
+}
+
+/*
+	parseFailInfo parses the FailInfo in js. ok is false if js is not a
+	failure reported by the service.
+*/
+func parseFailInfo(status int, js []byte) (info *FailInfo, ok bool) {
+	var failInfo struct {
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}
+
+	err := json.Unmarshal(js, &failInfo)
+	if err != nil || failInfo.Error == "" && failInfo.Message == "" {
+		return &FailInfo{
+			Message:    "Parse FailInfo failed: " + string(js),
+			Err:        "Invalid JSON",
+			StatusCode: status,
+			Body:       js,
+		}, false
+	}
+
+	return &FailInfo{
+		Message:    failInfo.Message,
+		Err:        failInfo.Error,
+		StatusCode: status,
+		Body:       js,
+	}, true
+}
+
+/*
+	checkResponse returns js if res has a 2xx status, or a *FailInfo describing
+	the failure otherwise.
+*/
+func checkResponse(res *http.Response, js []byte) ([]byte, error) {
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return js, nil
+	}
+
+	info, ok := parseFailInfo(res.StatusCode, js)
+	if !ok {
+		// Not a failure reported by the service, e.g. from a proxy.
+		info.Err = res.Status
+		info.Message = string(js)
+	}
+	info.RetryAfter = retryAfter(res)
+	return nil, info
+}
+
+/*
+	retryAfter returns the delay specified by the Retry-After header of res,
+	either in seconds or as an HTTP date. Returns 0 if res is nil or the header
+	is absent or invalid.
+*/
+func retryAfter(res *http.Response) time.Duration {
+	if res == nil {
+		return 0
+	}
+	v := res.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
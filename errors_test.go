@@ -0,0 +1,115 @@
+package ynote_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	ynote "github.com/youdao-api/go-ynote"
+	"github.com/youdao-api/go-ynote/ynotetest"
+)
+
+var sentinels = []error{ynote.ErrTokenExpired, ynote.ErrPermissionDenied,
+	ynote.ErrNotFound, ynote.ErrQuotaExceeded, ynote.ErrBadParameter,
+	ynote.ErrTooManyRequests}
+
+func TestFailInfoKind(t *testing.T) {
+	tests := []struct {
+		failure ynotetest.Failure
+		want    error
+	}{
+		{ynotetest.Failure{Err: string(ynote.CodeTokenExpired)}, ynote.ErrTokenExpired},
+		{ynotetest.Failure{Err: string(ynote.CodeNotFound)}, ynote.ErrNotFound},
+		{ynotetest.Failure{Err: string(ynote.CodeQuotaExceeded)}, ynote.ErrQuotaExceeded},
+		{ynotetest.Failure{Err: string(ynote.CodeBadParameter)}, ynote.ErrBadParameter},
+		{ynotetest.Failure{Err: "9999"}, nil},
+		{ynotetest.Failure{Status: http.StatusUnauthorized, Body: "no"}, ynote.ErrTokenExpired},
+		{ynotetest.Failure{Status: http.StatusForbidden, Body: "no"}, ynote.ErrPermissionDenied},
+		{ynotetest.Failure{Status: http.StatusNotFound, Body: "no"}, ynote.ErrNotFound},
+		{ynotetest.Failure{Status: http.StatusBadRequest, Body: "no"}, ynote.ErrBadParameter},
+		{ynotetest.Failure{Status: http.StatusRequestEntityTooLarge}, ynote.ErrQuotaExceeded},
+		{ynotetest.Failure{Status: http.StatusInsufficientStorage}, ynote.ErrQuotaExceeded},
+		{ynotetest.Failure{Status: http.StatusTooManyRequests}, ynote.ErrTooManyRequests},
+		// The code is more specific than the status.
+		{ynotetest.Failure{Status: http.StatusTooManyRequests,
+			Err: string(ynote.CodeQuotaExceeded)}, ynote.ErrQuotaExceeded},
+		{ynotetest.Failure{Status: http.StatusBadGateway, Body: "<html>"}, nil},
+	}
+
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	yc := srv.Client()
+	for _, test := range tests {
+		f := test.failure
+		f.Times = 1
+		srv.InjectFailure(f)
+		_, err := yc.UserInfo()
+
+		var fi *ynote.FailInfo
+		if !errors.As(err, &fi) {
+			t.Errorf("%+v: UserInfo: %v, want a *FailInfo", test.failure, err)
+			continue
+		}
+		if fi.Kind() != test.want {
+			t.Errorf("%+v: Kind() = %v, want %v", test.failure, fi.Kind(), test.want)
+		}
+		for _, sentinel := range sentinels {
+			if got := errors.Is(err, sentinel); got != (sentinel == test.want) {
+				t.Errorf("%+v: errors.Is(err, %v) = %v", test.failure, sentinel, got)
+			}
+		}
+	}
+}
+
+func TestFailInfoDetails(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	yc := srv.Client()
+
+	srv.InjectFailure(ynotetest.Failure{Times: 1, Err: string(ynote.CodeNotFound),
+		Message: "gone"})
+	_, err := yc.UserInfo()
+	var fi *ynote.FailInfo
+	if !errors.As(err, &fi) {
+		t.Fatalf("UserInfo: %v, want a *FailInfo", err)
+	}
+	if fi.Code() != ynote.CodeNotFound || fi.Message != "gone" ||
+		fi.StatusCode != http.StatusInternalServerError {
+		t.Errorf("FailInfo: %+v", fi)
+	}
+
+	// Not a failure reported by the service
+	srv.InjectFailure(ynotetest.Failure{Times: 1, Status: http.StatusServiceUnavailable,
+		Body: "maintenance", Header: http.Header{"Retry-After": {"120"}}})
+	_, err = yc.UserInfo()
+	if !errors.As(err, &fi) {
+		t.Fatalf("UserInfo: %v, want a *FailInfo", err)
+	}
+	if fi.Err != "503 Service Unavailable" || fi.Message != "maintenance" ||
+		string(fi.Body) != "maintenance" || fi.RetryAfter != 2*time.Minute {
+		t.Errorf("FailInfo: %+v", fi)
+	}
+}
+
+func TestRetryTooManyRequests(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	yc := srv.Client(ynote.WithRetryPolicy(fastRetries))
+
+	srv.InjectFailure(ynotetest.Failure{Times: 1, Status: http.StatusTooManyRequests})
+	if _, err := yc.UserInfo(); err != nil {
+		t.Fatalf("UserInfo: %v", err)
+	}
+
+	// An exhausted quota is not retried, whatever the status.
+	srv.InjectFailure(ynotetest.Failure{Times: 2, Status: http.StatusTooManyRequests,
+		Err: string(ynote.CodeQuotaExceeded)})
+	before := srv.Requests()
+	if _, err := yc.UserInfo(); !errors.Is(err, ynote.ErrQuotaExceeded) {
+		t.Fatalf("UserInfo: %v, want ErrQuotaExceeded", err)
+	}
+	if n := srv.Requests() - before; n != 1 {
+		t.Errorf("%d requests, want 1", n)
+	}
+}
@@ -0,0 +1,237 @@
+package ynote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+
+	"github.com/garyburd/go-oauth/oauth"
+)
+
+/*
+	ProgressFunc reports the progress of transferring an attachment named name:
+	done bytes out of total have been transferred. total is -1 if unknown.
+*/
+type ProgressFunc func(name string, done, total int64)
+
+/*
+	WithProgress sets a callback reporting the progress of uploading and
+	downloading attachments.
+*/
+func WithProgress(progress ProgressFunc) Option {
+	return func(yc *YnoteClient) {
+		yc.progress = progress
+	}
+}
+
+/* fileSource is a file field of a multipart request. */
+type fileSource struct {
+	filename string
+	// Size of the content in bytes, -1 if unknown
+	size int64
+	// open returns a fresh reader of the content for each attempt
+	open func() (io.ReadCloser, error)
+	// Optional, called when part of the content is sent
+	progress ProgressFunc
+}
+
+/*
+	errNotReplayable is returned when a request with the content of a plain
+	io.Reader is retried.
+*/
+var errNotReplayable = errors.New("ynote: attachment content cannot be read again for a retry")
+
+/*
+	readerOpener returns an open function for fileSource reading from r. If r is
+	an io.Seeker, every call rewinds it to its current position, otherwise only
+	the first call succeeds.
+*/
+func readerOpener(r io.Reader) func() (io.ReadCloser, error) {
+	if s, ok := r.(io.Seeker); ok {
+		start, err := s.Seek(0, io.SeekCurrent)
+		if err == nil {
+			return func() (io.ReadCloser, error) {
+				if _, err := s.Seek(start, io.SeekStart); err != nil {
+					return nil, err
+				}
+				return io.NopCloser(r), nil
+			}
+		}
+	}
+
+	opened := false
+	return func() (io.ReadCloser, error) {
+		if opened {
+			return nil, errNotReplayable
+		}
+		opened = true
+		return io.NopCloser(r), nil
+	}
+}
+
+/* progressReader calls progress after every Read. */
+type progressReader struct {
+	r        io.Reader
+	name     string
+	done     int64
+	total    int64
+	progress ProgressFunc
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	if n > 0 {
+		pr.done += int64(n)
+		pr.progress(pr.name, pr.done, pr.total)
+	}
+	return n, err
+}
+
+/* sortedKeys returns the keys of form in order, for a stable request body. */
+func sortedKeys(form url.Values) []string {
+	keys := make([]string, 0, len(form))
+	for k := range form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedFields(files map[string]fileSource) []string {
+	fields := make([]string, 0, len(files))
+	for field := range files {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+/*
+	writeMultipart writes form and files to mw. If readers is nil, the content
+	of files is not written, which is used for computing the length of the body.
+*/
+func writeMultipart(mw *multipart.Writer, form url.Values,
+	files map[string]fileSource, readers map[string]io.Reader) error {
+	for _, k := range sortedKeys(form) {
+		if err := mw.WriteField(k, form.Get(k)); err != nil {
+			return err
+		}
+	}
+
+	for _, field := range sortedFields(files) {
+		w, err := mw.CreateFormFile(field, filepath.Base(files[field].filename))
+		if err != nil {
+			return err
+		}
+		if readers == nil {
+			continue
+		}
+
+		if size := files[field].size; size >= 0 {
+			_, err = io.CopyN(w, readers[field], size)
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+		} else {
+			_, err = io.Copy(w, readers[field])
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", files[field].filename, err)
+		}
+	}
+	return mw.Close()
+}
+
+/* countWriter counts the bytes written to it. */
+type countWriter int64
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	*cw += countWriter(len(p))
+	return len(p), nil
+}
+
+/*
+	multipartLength returns the length of the multipart body with the
+	boundary, or -1 if the size of any file is unknown.
+*/
+func multipartLength(boundary string, form url.Values, files map[string]fileSource) (int64, error) {
+	var cw countWriter
+	mw := multipart.NewWriter(&cw)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return 0, err
+	}
+	if err := writeMultipart(mw, form, files, nil); err != nil {
+		return 0, err
+	}
+
+	length := int64(cw)
+	for _, file := range files {
+		if file.size < 0 {
+			return -1, nil
+		}
+		length += file.size
+	}
+	return length, nil
+}
+
+/*
+	multipartPost issues a POST with the specified form and files as
+	multipart/form-data. The body is streamed, so the content of the files is
+	never held in memory as a whole.
+*/
+func multipartPost(ctx context.Context, c *oauth.Client, client *http.Client,
+	credentials *oauth.Credentials, urlStr string, form url.Values,
+	files map[string]fileSource) (*http.Response, error) {
+	readers := make(map[string]io.Reader, len(files))
+	closeAll := func() {
+		for _, r := range readers {
+			r.(io.Closer).Close()
+		}
+	}
+	for field, file := range files {
+		r, err := file.open()
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		readers[field] = r
+	}
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	length, err := multipartLength(mw.Boundary(), form, files)
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+
+	// Wrapped readers for writing, the originals are kept for closing.
+	wrapped := make(map[string]io.Reader, len(readers))
+	for field, r := range readers {
+		if file := files[field]; file.progress != nil {
+			r = &progressReader{r: r, name: file.filename, total: file.size, progress: file.progress}
+		}
+		wrapped[field] = r
+	}
+	go func() {
+		defer closeAll()
+		pw.CloseWithError(writeMultipart(mw, form, files, wrapped))
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", urlStr, pr)
+	if err != nil {
+		pr.Close()
+		return nil, err
+	}
+	req.ContentLength = length
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	req.Header.Set("Authorization", c.AuthorizationHeader(credentials, "POST", req.URL, nil))
+	return client.Do(req)
+}
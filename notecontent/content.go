@@ -0,0 +1,296 @@
+/*
+	Package notecontent parses the HTML content of a note into a Document of
+	typed blocks and inlines, and renders it back to HTML.
+
+		doc := notecontent.Parse(ni.Content)
+		for _, img := range doc.Images() {
+			fmt.Println(img.Src)
+		}
+
+		ai, err := yc.UploadAttachment("report.pdf")
+		...
+		doc.Blocks = append(doc.Blocks, notecontent.NewParagraph(
+			notecontent.FromAttachInfo(ai)))
+		err = yc.UpdateNote(path, ni.Title, ni.Author, ni.Source,
+			doc.Render())
+
+	Paragraphs, headings, lists, tables, links, images and attachments are
+	recognized. Anything else is kept as a *Raw block or a *Span inline, so
+	content round-trips through Parse and Render without losing markup.
+
+	In notes, an image is an <img src="URL">, and an attachment an
+	<img path="URL" src="ICON"> showing the icon of the file type.
+*/
+package notecontent
+
+import (
+	"golang.org/x/net/html"
+
+	ynote "github.com/youdao-api/go-ynote"
+)
+
+/* Node is either a Block or an Inline. */
+type Node interface {
+	node()
+}
+
+/* Block is a block-level node: *Paragraph, *Heading, *List, *Table or *Raw. */
+type Block interface {
+	Node
+	block()
+}
+
+/*
+	Inline is an inline node: *Text, *Break, *Link, *Image, *Attachment,
+	*Span or *Raw.
+*/
+type Inline interface {
+	Node
+	inline()
+}
+
+/* Document is the content of a note. */
+type Document struct {
+	Blocks []Block
+}
+
+/* Paragraph is a run of inlines. */
+type Paragraph struct {
+	Inlines []Inline
+	// Attributes of the element, e.g. style
+	Attr []html.Attribute
+
+	// The tag name: "p", "div", or empty for inlines not in any element
+	tag string
+}
+
+/* NewParagraph returns a <p> paragraph of inlines. */
+func NewParagraph(inlines ...Inline) *Paragraph {
+	return &Paragraph{Inlines: inlines, tag: "p"}
+}
+
+/* Heading is a <h1> to <h6> heading. */
+type Heading struct {
+	// 1 to 6
+	Level   int
+	Inlines []Inline
+	Attr    []html.Attribute
+}
+
+/* List is an <ul>, or an <ol> if Ordered. */
+type List struct {
+	Ordered bool
+	Items   []*ListItem
+	Attr    []html.Attribute
+}
+
+/* ListItem is a <li> of a List. */
+type ListItem struct {
+	Blocks []Block
+	Attr   []html.Attribute
+}
+
+/* Table is a <table>. */
+type Table struct {
+	Rows []*TableRow
+	Attr []html.Attribute
+}
+
+/* TableRow is a <tr> of a Table. */
+type TableRow struct {
+	Cells []*TableCell
+	Attr  []html.Attribute
+}
+
+/* TableCell is a <td>, or a <th> if Header. */
+type TableCell struct {
+	Header bool
+	Blocks []Block
+	Attr   []html.Attribute
+}
+
+/*
+	Raw is a block or an inline kept as it is, e.g. a <pre>, a <blockquote>
+	or a comment.
+*/
+type Raw struct {
+	HTML string
+}
+
+/* Text is a run of plain text. */
+type Text struct {
+	Text string
+}
+
+/* Break is a <br>. */
+type Break struct{}
+
+/* Link is an <a href>, or an <a> without href, e.g. an <a name>. */
+type Link struct {
+	URL     string
+	Inlines []Inline
+	Attr    []html.Attribute
+
+	// Whether href is omitted, as parsed from an <a> without it
+	noURL bool
+}
+
+/* Image is an image uploaded to or linked from the note. */
+type Image struct {
+	Src  string
+	Alt  string
+	Attr []html.Attribute
+
+	// Whether src is omitted, as parsed from an <img> without it
+	noSrc bool
+}
+
+/* Attachment is a file attached to the note. */
+type Attachment struct {
+	// The URL of the file
+	URL string
+	// The URL of the icon shown for the file
+	Icon string
+	Attr []html.Attribute
+
+	// Whether src is omitted, as parsed from an <img path> without it
+	noIcon bool
+}
+
+/*
+	Span is any other inline element, e.g. <b> or <span style>, with its
+	children.
+*/
+type Span struct {
+	Tag     string
+	Inlines []Inline
+	Attr    []html.Attribute
+}
+
+func (*Paragraph) node()  {}
+func (*Heading) node()    {}
+func (*List) node()       {}
+func (*ListItem) node()   {}
+func (*Table) node()      {}
+func (*TableRow) node()   {}
+func (*TableCell) node()  {}
+func (*Raw) node()        {}
+func (*Text) node()       {}
+func (*Break) node()      {}
+func (*Link) node()       {}
+func (*Image) node()      {}
+func (*Attachment) node() {}
+func (*Span) node()       {}
+
+func (*Paragraph) block() {}
+func (*Heading) block()   {}
+func (*List) block()      {}
+func (*Table) block()     {}
+func (*Raw) block()       {}
+
+func (*Text) inline()       {}
+func (*Break) inline()      {}
+func (*Link) inline()       {}
+func (*Image) inline()      {}
+func (*Attachment) inline() {}
+func (*Span) inline()       {}
+func (*Raw) inline()        {}
+
+/*
+	FromAttachInfo returns the inline referencing an uploaded file: an *Image
+	for an image, and an *Attachment otherwise.
+*/
+func FromAttachInfo(ai *ynote.AttachInfo) Inline {
+	if ai.Src == "" {
+		return &Image{Src: ai.URL}
+	}
+	return &Attachment{URL: ai.URL, Icon: ai.Src}
+}
+
+/*
+	Walk calls fn for every node of doc in depth-first order. The children of
+	a node are skipped if fn returns false.
+*/
+func (doc *Document) Walk(fn func(n Node) bool) {
+	walkBlocks(doc.Blocks, fn)
+}
+
+func walkBlocks(blocks []Block, fn func(n Node) bool) {
+	for _, b := range blocks {
+		walk(b, fn)
+	}
+}
+
+func walkInlines(inlines []Inline, fn func(n Node) bool) {
+	for _, in := range inlines {
+		walk(in, fn)
+	}
+}
+
+func walk(n Node, fn func(n Node) bool) {
+	if !fn(n) {
+		return
+	}
+	switch n := n.(type) {
+	case *Paragraph:
+		walkInlines(n.Inlines, fn)
+	case *Heading:
+		walkInlines(n.Inlines, fn)
+	case *List:
+		for _, item := range n.Items {
+			walk(item, fn)
+		}
+	case *ListItem:
+		walkBlocks(n.Blocks, fn)
+	case *Table:
+		for _, row := range n.Rows {
+			walk(row, fn)
+		}
+	case *TableRow:
+		for _, cell := range n.Cells {
+			walk(cell, fn)
+		}
+	case *TableCell:
+		walkBlocks(n.Blocks, fn)
+	case *Link:
+		walkInlines(n.Inlines, fn)
+	case *Span:
+		walkInlines(n.Inlines, fn)
+	}
+}
+
+/* Images returns all images of doc. */
+func (doc *Document) Images() []*Image {
+	var res []*Image
+	doc.Walk(func(n Node) bool {
+		if img, ok := n.(*Image); ok {
+			res = append(res, img)
+		}
+		return true
+	})
+	return res
+}
+
+/* Attachments returns all attachments of doc. */
+func (doc *Document) Attachments() []*Attachment {
+	var res []*Attachment
+	doc.Walk(func(n Node) bool {
+		if a, ok := n.(*Attachment); ok {
+			res = append(res, a)
+		}
+		return true
+	})
+	return res
+}
+
+/* Links returns all links of doc. */
+func (doc *Document) Links() []*Link {
+	var res []*Link
+	doc.Walk(func(n Node) bool {
+		if l, ok := n.(*Link); ok {
+			res = append(res, l)
+		}
+		return true
+	})
+	return res
+}
@@ -0,0 +1,75 @@
+package notecontent
+
+import (
+	"reflect"
+	"testing"
+
+	ynote "github.com/youdao-api/go-ynote"
+)
+
+func TestParse(t *testing.T) {
+	doc := Parse(`<div style="color:red">Hi <b>there</b> <a href="http://x/">link</a></div>` +
+		`<h2>T</h2><ul><li>one</li><li><p>two</p><img src="http://i/1.png" alt="a"></li></ul>` +
+		`<table><tbody><tr><th>h</th></tr><tr><td><img path="http://f/1" src="http://icon/pdf"></td></tr></tbody></table>` +
+		`<pre>  code</pre>`)
+
+	if len(doc.Blocks) != 5 {
+		t.Fatalf("%d blocks, want 5", len(doc.Blocks))
+	}
+	for i, want := range []Block{&Paragraph{}, &Heading{}, &List{}, &Table{}, &Raw{}} {
+		if got := doc.Blocks[i]; reflect.TypeOf(got) != reflect.TypeOf(want) {
+			t.Errorf("block %d: %T, want %T", i, got, want)
+		}
+	}
+	if h := doc.Blocks[1].(*Heading); h.Level != 2 {
+		t.Errorf("heading level %d, want 2", h.Level)
+	}
+	if imgs := doc.Images(); len(imgs) != 1 || imgs[0].Src != "http://i/1.png" || imgs[0].Alt != "a" {
+		t.Errorf("Images: %+v", imgs)
+	}
+	if as := doc.Attachments(); len(as) != 1 || as[0].URL != "http://f/1" || as[0].Icon != "http://icon/pdf" {
+		t.Errorf("Attachments: %+v", as)
+	}
+	if ls := doc.Links(); len(ls) != 1 || ls[0].URL != "http://x/" {
+		t.Errorf("Links: %+v", ls)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, content := range []string{
+		`<p>a &amp; b &lt;c&gt;</p>`,
+		`<div style="color:red">Hi <b>there</b><br></div>`,
+		`plain <i>text</i>`,
+		`<p><a href="http://x/?a=1&amp;b=2" title="t">link</a></p>`,
+		`<p><a name="x">anchor</a></p>`,
+		`<p><a href="">empty</a></p>`,
+		`<p><img alt="no source"></p>`,
+		`<p><img src="" alt="empty source"></p>`,
+		`<p><img path="http://f/1" width="10"></p>`,
+		`<p><b>x<!-- c -->y</b></p>`,
+		`<h1>a<!-- c --></h1>`,
+		`text<!-- c -->`,
+		`<!-- c --><p>a</p>`,
+		`<ol><li>one</li><li><p>two</p><ul><li>three</li></ul></li></ol>`,
+		`<table><tr><th>h</th></tr><tr><td>c</td></tr></table>`,
+		`<pre>  code</pre><blockquote>q</blockquote>`,
+	} {
+		if got := Parse(content).Render(); got != content {
+			t.Errorf("%s rendered as %s", content, got)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	doc := &Document{Blocks: []Block{
+		&Heading{Level: 7, Inlines: []Inline{&Text{Text: "a<b"}}},
+		NewParagraph(&Link{URL: "http://x/", Inlines: []Inline{&Text{Text: "x"}}},
+			&Image{Src: ""},
+			FromAttachInfo(&ynote.AttachInfo{URL: "http://f/2", Src: "http://icon/zip"})),
+	}}
+	want := `<h6>a&lt;b</h6><p><a href="http://x/">x</a><img src="">` +
+		`<img path="http://f/2" src="http://icon/zip"></p>`
+	if got := doc.Render(); got != want {
+		t.Errorf("Render: %s, want %s", got, want)
+	}
+}
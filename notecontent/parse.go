@@ -0,0 +1,243 @@
+package notecontent
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+/* Elements parsed as inlines */
+var inlineElements = map[atom.Atom]bool{
+	atom.A: true, atom.Abbr: true, atom.B: true, atom.Bdi: true,
+	atom.Bdo: true, atom.Br: true, atom.Cite: true, atom.Code: true,
+	atom.Data: true, atom.Del: true, atom.Dfn: true, atom.Em: true,
+	atom.Font: true, atom.I: true, atom.Img: true, atom.Ins: true,
+	atom.Kbd: true, atom.Label: true, atom.Mark: true, atom.Q: true,
+	atom.S: true, atom.Samp: true, atom.Small: true, atom.Span: true,
+	atom.Strike: true, atom.Strong: true, atom.Sub: true, atom.Sup: true,
+	atom.Time: true, atom.U: true, atom.Var: true, atom.Wbr: true,
+}
+
+/*
+	Parse parses the HTML content of a note. Like browsers, it accepts any
+	content, so it never fails.
+*/
+func Parse(content string) *Document {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(content), body)
+	if err != nil {
+		// Only errors reading the content are returned.
+		return &Document{Blocks: []Block{&Raw{HTML: content}}}
+	}
+	return &Document{Blocks: parseBlocks(nodes)}
+}
+
+func children(n *html.Node) []*html.Node {
+	var res []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		res = append(res, c)
+	}
+	return res
+}
+
+func isInline(n *html.Node) bool {
+	return n.Type == html.TextNode || n.Type == html.CommentNode ||
+		n.Type == html.ElementNode && inlineElements[n.DataAtom]
+}
+
+func isSpace(n *html.Node) bool {
+	return n.Type == html.TextNode && strings.TrimSpace(n.Data) == ""
+}
+
+/*
+	parseBlocks parses nodes as blocks. Runs of inline nodes become
+	paragraphs without tags, except whitespace between blocks, which is
+	dropped.
+*/
+func parseBlocks(nodes []*html.Node) []Block {
+	var blocks []Block
+	var run []*html.Node
+	flush := func() {
+		for _, n := range run {
+			if !isSpace(n) {
+				blocks = append(blocks, &Paragraph{Inlines: parseInlines(run)})
+				break
+			}
+		}
+		run = nil
+	}
+
+	for _, n := range nodes {
+		if isInline(n) {
+			run = append(run, n)
+			continue
+		}
+		flush()
+		blocks = append(blocks, parseBlock(n))
+	}
+	flush()
+
+	return blocks
+}
+
+func parseBlock(n *html.Node) Block {
+	if n.Type != html.ElementNode {
+		return rawNode(n)
+	}
+
+	switch n.DataAtom {
+	case atom.P, atom.Div:
+		for _, c := range children(n) {
+			if !isInline(c) {
+				return rawNode(n)
+			}
+		}
+		return &Paragraph{Inlines: parseInlines(children(n)), Attr: n.Attr,
+			tag: n.Data}
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		return &Heading{Level: int(n.Data[1] - '0'),
+			Inlines: parseInlines(children(n)), Attr: n.Attr}
+	case atom.Ul, atom.Ol:
+		if l := parseList(n); l != nil {
+			return l
+		}
+	case atom.Table:
+		if t := parseTable(n); t != nil {
+			return t
+		}
+	}
+
+	return rawNode(n)
+}
+
+/* parseList returns nil if n has children other than <li>s. */
+func parseList(n *html.Node) *List {
+	l := &List{Ordered: n.DataAtom == atom.Ol, Attr: n.Attr}
+	for _, c := range children(n) {
+		switch {
+		case c.Type == html.ElementNode && c.DataAtom == atom.Li:
+			l.Items = append(l.Items, &ListItem{
+				Blocks: parseBlocks(children(c)), Attr: c.Attr})
+		case isSpace(c):
+		default:
+			return nil
+		}
+	}
+	return l
+}
+
+/*
+	parseTable returns nil if n has anything other than rows, e.g. a
+	<caption>. The sections (<thead>, <tbody>, ...) are not kept.
+*/
+func parseTable(n *html.Node) *Table {
+	t := &Table{Attr: n.Attr}
+	var parseRows func(n *html.Node) bool
+	parseRows = func(n *html.Node) bool {
+		for _, c := range children(n) {
+			switch {
+			case isSpace(c):
+			case c.Type != html.ElementNode:
+				return false
+			case c.DataAtom == atom.Thead, c.DataAtom == atom.Tbody,
+				c.DataAtom == atom.Tfoot:
+				if !parseRows(c) {
+					return false
+				}
+			case c.DataAtom == atom.Tr:
+				row := &TableRow{Attr: c.Attr}
+				for _, cell := range children(c) {
+					switch {
+					case isSpace(cell):
+					case cell.Type == html.ElementNode &&
+						(cell.DataAtom == atom.Td || cell.DataAtom == atom.Th):
+						row.Cells = append(row.Cells, &TableCell{
+							Header: cell.DataAtom == atom.Th,
+							Blocks: parseBlocks(children(cell)),
+							Attr:   cell.Attr,
+						})
+					default:
+						return false
+					}
+				}
+				t.Rows = append(t.Rows, row)
+			default:
+				return false
+			}
+		}
+		return true
+	}
+
+	if !parseRows(n) {
+		return nil
+	}
+	return t
+}
+
+func rawNode(n *html.Node) *Raw {
+	var sb strings.Builder
+	html.Render(&sb, n)
+	return &Raw{HTML: sb.String()}
+}
+
+/*
+	getAttr returns the value of attribute key, whether it is present, and the
+	other attributes.
+*/
+func getAttr(attr []html.Attribute, key string) (string, bool, []html.Attribute) {
+	var val string
+	var found bool
+	var rest []html.Attribute
+	for _, a := range attr {
+		if a.Namespace == "" && a.Key == key {
+			val, found = a.Val, true
+		} else {
+			rest = append(rest, a)
+		}
+	}
+	return val, found, rest
+}
+
+func parseInlines(nodes []*html.Node) []Inline {
+	var inlines []Inline
+	for _, n := range nodes {
+		if in := parseInline(n); in != nil {
+			inlines = append(inlines, in)
+		}
+	}
+	return inlines
+}
+
+/*
+	parseInline returns nil for nodes other than text, comments and elements.
+*/
+func parseInline(n *html.Node) Inline {
+	switch n.Type {
+	case html.TextNode:
+		return &Text{Text: n.Data}
+	case html.CommentNode:
+		return rawNode(n)
+	case html.ElementNode:
+	default:
+		return nil
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		return &Break{}
+	case atom.A:
+		href, hasHref, attr := getAttr(n.Attr, "href")
+		return &Link{URL: href, Inlines: parseInlines(children(n)), Attr: attr,
+			noURL: !hasHref}
+	case atom.Img:
+		src, hasSrc, attr := getAttr(n.Attr, "src")
+		if path, _, attr := getAttr(attr, "path"); path != "" {
+			return &Attachment{URL: path, Icon: src, Attr: attr, noIcon: !hasSrc}
+		}
+		alt, _, attr := getAttr(attr, "alt")
+		return &Image{Src: src, Alt: alt, Attr: attr, noSrc: !hasSrc}
+	}
+
+	return &Span{Tag: n.Data, Inlines: parseInlines(children(n)), Attr: n.Attr}
+}
@@ -0,0 +1,156 @@
+package notecontent
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+/* Render returns the HTML of doc, e.g. for ynote.YnoteClient.UpdateNote. */
+func (doc *Document) Render() string {
+	var sb strings.Builder
+	renderBlocks(&sb, doc.Blocks)
+	return sb.String()
+}
+
+func renderBlocks(sb *strings.Builder, blocks []Block) {
+	for _, b := range blocks {
+		renderBlock(sb, b)
+	}
+}
+
+func renderBlock(sb *strings.Builder, b Block) {
+	switch b := b.(type) {
+	case *Paragraph:
+		tag := b.tag
+		if tag == "" {
+			if len(b.Attr) == 0 {
+				renderInlines(sb, b.Inlines)
+				return
+			}
+			// Attributes need an element.
+			tag = "div"
+		}
+		renderElement(sb, tag, b.Attr, func() {
+			renderInlines(sb, b.Inlines)
+		})
+	case *Heading:
+		level := b.Level
+		if level < 1 {
+			level = 1
+		} else if level > 6 {
+			level = 6
+		}
+		renderElement(sb, "h"+strconv.Itoa(level), b.Attr, func() {
+			renderInlines(sb, b.Inlines)
+		})
+	case *List:
+		tag := "ul"
+		if b.Ordered {
+			tag = "ol"
+		}
+		renderElement(sb, tag, b.Attr, func() {
+			for _, item := range b.Items {
+				renderElement(sb, "li", item.Attr, func() {
+					renderBlocks(sb, item.Blocks)
+				})
+			}
+		})
+	case *Table:
+		renderElement(sb, "table", b.Attr, func() {
+			for _, row := range b.Rows {
+				renderElement(sb, "tr", row.Attr, func() {
+					for _, cell := range row.Cells {
+						tag := "td"
+						if cell.Header {
+							tag = "th"
+						}
+						renderElement(sb, tag, cell.Attr, func() {
+							renderBlocks(sb, cell.Blocks)
+						})
+					}
+				})
+			}
+		})
+	case *Raw:
+		sb.WriteString(b.HTML)
+	}
+}
+
+func renderInlines(sb *strings.Builder, inlines []Inline) {
+	for _, in := range inlines {
+		renderInline(sb, in)
+	}
+}
+
+func renderInline(sb *strings.Builder, in Inline) {
+	switch in := in.(type) {
+	case *Text:
+		sb.WriteString(html.EscapeString(in.Text))
+	case *Break:
+		sb.WriteString("<br>")
+	case *Link:
+		var attr []html.Attribute
+		if in.URL != "" || !in.noURL {
+			attr = append(attr, html.Attribute{Key: "href", Val: in.URL})
+		}
+		renderElement(sb, "a", append(attr, in.Attr...), func() {
+			renderInlines(sb, in.Inlines)
+		})
+	case *Image:
+		var attr []html.Attribute
+		if in.Src != "" || !in.noSrc {
+			attr = append(attr, html.Attribute{Key: "src", Val: in.Src})
+		}
+		if in.Alt != "" {
+			attr = append(attr, html.Attribute{Key: "alt", Val: in.Alt})
+		}
+		renderElement(sb, "img", append(attr, in.Attr...), nil)
+	case *Attachment:
+		attr := []html.Attribute{{Key: "path", Val: in.URL}}
+		if in.Icon != "" || !in.noIcon {
+			attr = append(attr, html.Attribute{Key: "src", Val: in.Icon})
+		}
+		renderElement(sb, "img", append(attr, in.Attr...), nil)
+	case *Raw:
+		sb.WriteString(in.HTML)
+	case *Span:
+		renderElement(sb, in.Tag, in.Attr, func() {
+			renderInlines(sb, in.Inlines)
+		})
+	}
+}
+
+/*
+	renderElement renders an element, calling children to render its
+	children. Void elements, e.g. <img>, have no children and no end tag.
+*/
+func renderElement(sb *strings.Builder, tag string, attr []html.Attribute, children func()) {
+	sb.WriteString("<" + tag)
+	for _, a := range attr {
+		key := a.Key
+		if a.Namespace != "" {
+			key = a.Namespace + ":" + key
+		}
+		sb.WriteString(" " + key + `="` + html.EscapeString(a.Val) + `"`)
+	}
+	sb.WriteString(">")
+
+	if voidElements[atom.Lookup([]byte(tag))] {
+		return
+	}
+	if children != nil {
+		children()
+	}
+	sb.WriteString("</" + tag + ">")
+}
+
+/* Elements without end tags */
+var voidElements = map[atom.Atom]bool{
+	atom.Area: true, atom.Base: true, atom.Br: true, atom.Col: true,
+	atom.Embed: true, atom.Hr: true, atom.Img: true, atom.Input: true,
+	atom.Link: true, atom.Meta: true, atom.Param: true, atom.Source: true,
+	atom.Track: true, atom.Wbr: true,
+}
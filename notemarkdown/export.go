@@ -0,0 +1,492 @@
+package notemarkdown
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	ynote "github.com/youdao-api/go-ynote"
+	"github.com/youdao-api/go-ynote/notecontent"
+)
+
+/*
+	Export converts a note to Markdown, with the title, author, source and
+	times of the note as YAML front matter:
+
+		---
+		title: "Design"
+		author: "ycon"
+		created: 2015-06-29T08:41:31+08:00
+		modified: 2015-06-29T08:41:31+08:00
+		---
+
+	The Markdown is meant to be saved in directory dir. Images stored by the
+	service, i.e. with /yws/ in the path of the URL, are downloaded via s into
+	the directory assets under dir, and referenced by relative paths. Other
+	images, and all images if s is nil, are referenced by their URLs.
+	Attachments become links to their URLs.
+
+	Markup with no Markdown equivalent is kept as HTML.
+*/
+func Export(ctx context.Context, s ynote.NoteService, ni *ynote.NoteInfo, dir, assets string) (string, error) {
+	e := &exporter{ctx: ctx, s: s, dir: dir, assets: assets,
+		saved: make(map[string]string), names: make(map[string]bool)}
+
+	doc := notecontent.Parse(ni.Content)
+	if s != nil {
+		for _, img := range doc.Images() {
+			if err := e.download(img); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	var sb strings.Builder
+	writeFrontMatter(&sb, ni)
+	sb.WriteString(strings.TrimSpace(e.blocks(doc.Blocks)))
+	sb.WriteString("\n")
+	return sb.String(), nil
+}
+
+func writeFrontMatter(sb *strings.Builder, ni *ynote.NoteInfo) {
+	sb.WriteString("---\n")
+	for _, f := range []struct{ key, val string }{
+		{"title", ni.Title}, {"author", ni.Author}, {"source", ni.Source},
+	} {
+		if f.val != "" {
+			// A double-quoted Go string is a valid YAML scalar.
+			sb.WriteString(f.key + ": " + strconv.Quote(f.val) + "\n")
+		}
+	}
+	for _, f := range []struct {
+		key string
+		t   time.Time
+	}{
+		{"created", ni.CreateTime}, {"modified", ni.ModifyTime},
+	} {
+		if !f.t.IsZero() {
+			sb.WriteString(f.key + ": " + f.t.Format(time.RFC3339) + "\n")
+		}
+	}
+	sb.WriteString("---\n\n")
+}
+
+type exporter struct {
+	ctx    context.Context
+	s      ynote.NoteService
+	dir    string
+	assets string
+
+	// The relative paths of the downloaded images by URLs
+	saved map[string]string
+	// The file names used in assets
+	names map[string]bool
+}
+
+func isServiceURL(u string) bool {
+	return strings.Contains(u, "/yws/")
+}
+
+/*
+	download saves a stored image into the assets directory and points it to
+	the saved file.
+*/
+func (e *exporter) download(img *notecontent.Image) error {
+	if !isServiceURL(img.Src) {
+		return nil
+	}
+	if rel, ok := e.saved[img.Src]; ok {
+		img.Src = rel
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Join(e.dir, e.assets), 0755); err != nil {
+		return err
+	}
+	name := e.uniqueName(img.Src)
+	fn := filepath.Join(e.dir, e.assets, name)
+	f, err := os.Create(fn)
+	if err != nil {
+		return err
+	}
+	_, err = e.s.DownloadAttachment(e.ctx, img.Src, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(fn)
+		return fmt.Errorf("download %s: %w", img.Src, err)
+	}
+
+	rel := path.Join(filepath.ToSlash(e.assets), name)
+	e.saved[img.Src] = rel
+	img.Src = rel
+	return nil
+}
+
+/* uniqueName returns a file name for an image not used by others. */
+func (e *exporter) uniqueName(u string) string {
+	base := path.Base(strings.SplitN(u, "?", 2)[0])
+	if base == "" || base == "." || base == "/" {
+		base = "image"
+	}
+	ext := path.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	name := base
+	for i := 1; e.names[name]; i++ {
+		name = stem + "-" + strconv.Itoa(i) + ext
+	}
+	e.names[name] = true
+	return name
+}
+
+/* blocks returns the Markdown of blocks, each followed by an empty line. */
+func (e *exporter) blocks(blocks []notecontent.Block) string {
+	var sb strings.Builder
+	for _, b := range blocks {
+		if md := e.block(b); md != "" {
+			sb.WriteString(md + "\n\n")
+		}
+	}
+	return sb.String()
+}
+
+func (e *exporter) block(b notecontent.Block) string {
+	switch b := b.(type) {
+	case *notecontent.Paragraph:
+		return escapeLineStarts(strings.TrimSpace(e.inlines(b.Inlines)))
+	case *notecontent.Heading:
+		return strings.Repeat("#", b.Level) + " " +
+			strings.TrimSpace(e.inlines(b.Inlines))
+	case *notecontent.List:
+		var sb strings.Builder
+		for i, item := range b.Items {
+			marker := "- "
+			if b.Ordered {
+				marker = strconv.Itoa(i+1) + ". "
+			}
+			sb.WriteString(marker + indent(e.item(item), len(marker)) + "\n")
+		}
+		return strings.TrimSuffix(sb.String(), "\n")
+	case *notecontent.Table:
+		return e.table(b)
+	case *notecontent.Raw:
+		return e.raw(b.HTML)
+	}
+	return ""
+}
+
+/*
+	item returns the Markdown of the blocks of a list item. A nested list
+	follows the preceding block directly, keeping the list tight.
+*/
+func (e *exporter) item(item *notecontent.ListItem) string {
+	var sb strings.Builder
+	for i, b := range item.Blocks {
+		md := e.block(b)
+		if md == "" {
+			continue
+		}
+		if sb.Len() > 0 {
+			if _, ok := item.Blocks[i].(*notecontent.List); ok {
+				sb.WriteString("\n")
+			} else {
+				sb.WriteString("\n\n")
+			}
+		}
+		sb.WriteString(md)
+	}
+	return sb.String()
+}
+
+/* indent indents the lines of md but the first, except empty ones. */
+func indent(md string, n int) string {
+	lines := strings.Split(md, "\n")
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" {
+			lines[i] = strings.Repeat(" ", n) + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+/* table returns a GFM table, with the first row as the header. */
+func (e *exporter) table(t *notecontent.Table) string {
+	if len(t.Rows) == 0 {
+		return ""
+	}
+	cols := 0
+	for _, row := range t.Rows {
+		if len(row.Cells) > cols {
+			cols = len(row.Cells)
+		}
+	}
+
+	var sb strings.Builder
+	for i, row := range t.Rows {
+		sb.WriteString("|")
+		for j := 0; j < cols; j++ {
+			var cell string
+			if j < len(row.Cells) {
+				cell = e.cell(row.Cells[j])
+			}
+			sb.WriteString(" " + cell + " |")
+		}
+		sb.WriteString("\n")
+		if i == 0 {
+			sb.WriteString("|" + strings.Repeat(" --- |", cols) + "\n")
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+/* cell returns the content of a table cell on a single line. */
+func (e *exporter) cell(c *notecontent.TableCell) string {
+	md := strings.TrimSpace(e.blocks(c.Blocks))
+	md = strings.Replace(md, "\n\n", "<br>", -1)
+	md = strings.Replace(md, "\n", " ", -1)
+	return strings.Replace(md, "|", `\|`, -1)
+}
+
+/*
+	raw converts the blocks kept as HTML by notecontent that have Markdown
+	equivalents, and returns others as they are.
+*/
+func (e *exporter) raw(h string) string {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(h), body)
+	if err != nil || len(nodes) != 1 {
+		return h
+	}
+
+	n := nodes[0]
+	switch {
+	case n.Type == html.CommentNode:
+		return ""
+	case n.Type != html.ElementNode:
+		return h
+	}
+
+	switch n.DataAtom {
+	case atom.Pre:
+		code := strings.TrimSuffix(textOf(n), "\n")
+		fence := "```"
+		for strings.Contains(code, fence) {
+			fence += "`"
+		}
+		return fence + "\n" + code + "\n" + fence
+	case atom.Hr:
+		return "---"
+	case atom.Blockquote, atom.Div:
+		md := strings.TrimSpace(e.blocks(notecontent.Parse(innerHTML(n)).Blocks))
+		if n.DataAtom == atom.Div {
+			return md
+		}
+		return "> " + strings.Replace(md, "\n", "\n> ", -1)
+	}
+	return h
+}
+
+func textOf(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(textOf(c))
+	}
+	return sb.String()
+}
+
+func innerHTML(n *html.Node) string {
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		html.Render(&sb, c)
+	}
+	return sb.String()
+}
+
+func (e *exporter) inlines(inlines []notecontent.Inline) string {
+	var sb strings.Builder
+	for _, in := range inlines {
+		sb.WriteString(e.inline(in))
+	}
+	return sb.String()
+}
+
+var emphasis = map[string]string{
+	"b": "**", "strong": "**", "i": "*", "em": "*",
+	"s": "~~", "strike": "~~", "del": "~~",
+}
+
+func (e *exporter) inline(in notecontent.Inline) string {
+	switch in := in.(type) {
+	case *notecontent.Text:
+		// Whitespace, including newlines, is collapsed in HTML.
+		return escape(strings.Join(strings.Fields(in.Text), " "), in.Text)
+	case *notecontent.Break:
+		return "\\\n"
+	case *notecontent.Link:
+		return "[" + e.inlines(in.Inlines) + "](" + destination(in.URL) + ")"
+	case *notecontent.Image:
+		return "![" + escape(in.Alt, in.Alt) + "](" + destination(in.Src) + ")"
+	case *notecontent.Attachment:
+		name := path.Base(strings.SplitN(in.URL, "?", 2)[0])
+		return "[" + escape(name, name) + "](" + destination(in.URL) + ")"
+	case *notecontent.Span:
+		if in.Tag == "code" {
+			return codeSpan(plainText(in.Inlines))
+		}
+		md := e.inlines(in.Inlines)
+		if mark, ok := emphasis[in.Tag]; ok && strings.TrimSpace(md) != "" {
+			return mark + md + mark
+		}
+		if in.Tag == "span" && len(in.Attr) == 0 {
+			return md
+		}
+		return inlineHTML(in, md)
+	}
+	return ""
+}
+
+/* plainText returns the text of inlines, as in a code span. */
+func plainText(inlines []notecontent.Inline) string {
+	var sb strings.Builder
+	for _, in := range inlines {
+		switch in := in.(type) {
+		case *notecontent.Text:
+			sb.WriteString(in.Text)
+		case *notecontent.Break:
+			sb.WriteString(" ")
+		case *notecontent.Link:
+			sb.WriteString(plainText(in.Inlines))
+		case *notecontent.Span:
+			sb.WriteString(plainText(in.Inlines))
+		}
+	}
+	return sb.String()
+}
+
+/*
+	codeSpan returns a code span of text, fenced by one more backtick than
+	the longest run of backticks in it.
+*/
+func codeSpan(text string) string {
+	// Line endings are spaces in code spans.
+	text = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(text)
+	longest, run := 0, 0
+	for _, r := range text {
+		if r == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", longest+1)
+	// One space is stripped from both ends of the content, if any.
+	if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") ||
+		strings.HasPrefix(text, " ") && strings.HasSuffix(text, " ") &&
+			strings.TrimSpace(text) != "" {
+		text = " " + text + " "
+	}
+	return fence + text + fence
+}
+
+/*
+	inlineHTML returns an element with no Markdown equivalent, e.g. <u> or
+	<span style>, as inline HTML around the Markdown of its children.
+*/
+func inlineHTML(in *notecontent.Span, md string) string {
+	var sb strings.Builder
+	sb.WriteString("<" + in.Tag)
+	for _, a := range in.Attr {
+		sb.WriteString(" " + a.Key + `="` + html.EscapeString(a.Val) + `"`)
+	}
+	sb.WriteString(">")
+	if atom.Lookup([]byte(in.Tag)) == atom.Wbr {
+		return sb.String()
+	}
+	return sb.String() + md + "</" + in.Tag + ">"
+}
+
+var mdEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+	"<", `\<`, "#", `\#`,
+)
+
+/* entity matches an HTML entity or numeric character reference. */
+var entity = regexp.MustCompile(`&(#[0-9]+|#[xX][0-9a-fA-F]+|[A-Za-z][A-Za-z0-9]*);`)
+
+/*
+	escape escapes the characters of collapsed with special meanings in
+	Markdown, keeping a leading or trailing space of text, which separates it
+	from the neighbouring inlines.
+*/
+func escape(collapsed, text string) string {
+	s := entity.ReplaceAllString(mdEscaper.Replace(collapsed), `\$0`)
+	if s == "" {
+		if text != "" {
+			return " "
+		}
+		return ""
+	}
+	if strings.TrimLeft(text, " \t\r\n") != text {
+		s = " " + s
+	}
+	if strings.TrimRight(text, " \t\r\n") != text {
+		s += " "
+	}
+	return s
+}
+
+/*
+	Patterns of the starts of lines taken as block markers, with the marker
+	as the second submatch
+*/
+var blockMarkers = []*regexp.Regexp{
+	// List items and thematic breaks
+	regexp.MustCompile(`^( *)([-+*])([ \t].*)?$`),
+	regexp.MustCompile(`^( *[0-9]{1,9})([.)])([ \t].*)?$`),
+	// Block quotes and fenced code blocks
+	regexp.MustCompile(`^( *)(>|~~~)(.*)$`),
+	// Setext heading underlines and thematic breaks
+	regexp.MustCompile(`^( *)([-=])([-= \t]*)$`),
+}
+
+/*
+	escapeLineStarts escapes the characters at the starts of the lines of a
+	paragraph which would be taken as block markers, e.g. "- " of a list item
+	or "===" of a heading underline.
+*/
+func escapeLineStarts(md string) string {
+	lines := strings.Split(md, "\n")
+	for i, line := range lines {
+		for _, re := range blockMarkers {
+			if re.MatchString(line) {
+				lines[i] = re.ReplaceAllString(line, `$1\$2$3`)
+				break
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+/* destination returns u as a link destination. */
+func destination(u string) string {
+	if strings.ContainsAny(u, " ()<>") {
+		return "<" + strings.Replace(u, ">", "%3E", -1) + ">"
+	}
+	return u
+}
@@ -0,0 +1,140 @@
+package notemarkdown
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ynote "github.com/youdao-api/go-ynote"
+	"github.com/youdao-api/go-ynote/notecontent"
+	"github.com/youdao-api/go-ynote/ynotetest"
+)
+
+func TestExport(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	yc := srv.Client()
+	png := []byte("\x89PNG\r\n\x1a\n0000000000000")
+	img, err := yc.UploadAttachmentReader(context.Background(), "a.png",
+		strings.NewReader(string(png)), int64(len(png)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdf, err := yc.UploadAttachmentReader(context.Background(), "r.pdf",
+		strings.NewReader("%PDF-1.4"), 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ni := &ynote.NoteInfo{
+		Title:      `Design "v2"`,
+		Author:     "ycon",
+		CreateTime: time.Unix(1435538491, 0).UTC(),
+		ModifyTime: time.Unix(1435538491, 0).UTC(),
+		Content: `<h1>Title</h1><p>Some <i>em</i> and <b>strong</b> <a href="http://x.com/a_b">l</a></p>` +
+			`<table><tr><th>a</th><th>b</th></tr><tr><td>1</td><td>2</td></tr></table>` +
+			`<ul><li>one</li><li>two<ol><li>nested</li></ol></li></ul>` +
+			`<blockquote>quote</blockquote><pre>code</pre>` +
+			`<p><img src="` + img.URL + `"><img src="` + img.URL + `"><img src="http://e.com/x.png"></p>` +
+			`<p>file: <img path="` + pdf.URL + `" src="` + pdf.Src + `"></p>`,
+	}
+	dir := t.TempDir()
+	md, err := Export(context.Background(), yc, ni, dir, "assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"---\ntitle: \"Design \\\"v2\\\"\"\nauthor: \"ycon\"\ncreated: 2015-06-29T00:41:31Z\n",
+		"# Title\n", "Some *em* and **strong** [l](http://x.com/a_b)",
+		"| a | b |\n| --- | --- |\n| 1 | 2 |", "- one\n- two\n  1. nested",
+		"> quote", "```\ncode\n```", "![](http://e.com/x.png)",
+		"[" + filepath.Base(pdf.URL) + "](" + pdf.URL + ")",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("%q not in %s", want, md)
+		}
+	}
+
+	// The image shown twice is downloaded once.
+	fis, err := ioutil.ReadDir(filepath.Join(dir, "assets"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fis) != 1 {
+		t.Fatalf("%d files downloaded, want 1", len(fis))
+	}
+	rel := "assets/" + fis[0].Name()
+	if n := strings.Count(md, "]("+rel+")"); n != 2 {
+		t.Errorf("%d references to %s in %s, want 2", n, rel, md)
+	}
+	if got, _ := ioutil.ReadFile(filepath.Join(dir, "assets", fis[0].Name())); string(got) != string(png) {
+		t.Errorf("downloaded %q, want %q", got, png)
+	}
+}
+
+/* exportContent returns the Markdown of content, without front matter. */
+func exportContent(t *testing.T, content string) string {
+	t.Helper()
+	md, err := Export(context.Background(), nil, &ynote.NoteInfo{Content: content}, "", "assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, body := SplitFrontMatter([]byte(md))
+	return strings.TrimSpace(string(body))
+}
+
+func TestExportInlines(t *testing.T) {
+	md := exportContent(t, "<p><code>a*b_c</code> <code>x`y</code> <code>`z</code> "+
+		`<u>under *x*</u> H<sub>2</sub>O <span style="color:red">r</span> <span>plain</span></p>`)
+	for _, want := range []string{
+		"`a*b_c`", "``x`y``", "`` `z ``", `<u>under \*x\*</u>`, "<sub>2</sub>",
+		`<span style="color:red">r</span>`, " plain",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("%q not in %s", want, md)
+		}
+	}
+
+	h, err := Convert(context.Background(), nil, "", []byte(md))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<code>a*b_c</code>", "<code>x`y</code>", "<code>`z</code>"} {
+		if !strings.Contains(h, want) {
+			t.Errorf("%s not in %s", want, h)
+		}
+	}
+}
+
+func TestExportEscapes(t *testing.T) {
+	for _, text := range []string{
+		"- not a list", "+ not a list", "-", "> not a quote", "# not a heading",
+		"1. not a list", "2) not a list", "---", "===", "- - -", "***", "~~~ not code",
+		"*not em*", "_not em_", "`not code`", "[not](a link)", "<b>not html</b>",
+		`a \ b`, "&amp; &#169; &#x41; & ;", "50 & 60; 1.5",
+	} {
+		for _, content := range []string{
+			"<p>" + escapeHTML(text) + "</p>",
+			"<p>line<br>" + escapeHTML(text) + "</p>",
+		} {
+			md := exportContent(t, content)
+			h, err := Convert(context.Background(), nil, "", []byte(md))
+			if err != nil {
+				t.Fatal(err)
+			}
+			blocks := notecontent.Parse(h).Blocks
+			if len(blocks) != 1 || !strings.HasPrefix(h, "<p>") ||
+				!strings.HasSuffix(plainText(blocks[0].(*notecontent.Paragraph).Inlines), text) {
+				t.Errorf("%s exported as %q, converted to %s", content, md, h)
+			}
+		}
+	}
+}
+
+func escapeHTML(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
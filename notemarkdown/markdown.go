@@ -0,0 +1,249 @@
+/*
+	Package notemarkdown converts Markdown documents to the HTML content of
+	notes, and notes back to Markdown.
+
+		md, err := ioutil.ReadFile("docs/design.md")
+		...
+		content, err := notemarkdown.Convert(ctx, yc, "docs", md)
+		...
+		path, err := yc.CreateNote(nb.Path, "Design", "", "", content)
+
+	The Markdown is CommonMark with the GitHub Flavored Markdown extensions:
+	tables, strikethrough, autolinks and task lists. Local images in the
+	directory of the document are uploaded by UploadAttachmentContext and
+	referenced by the returned URL. A YAML front matter block, e.g. the one
+	written by Export, is not converted; SplitFrontMatter returns the title
+	in it for the note.
+
+	Export does the reverse, downloading the images of the note:
+
+		ni, err := yc.NoteInfo(path)
+		...
+		md, err := notemarkdown.Export(ctx, yc, ni, "docs", "assets")
+		...
+		err = ioutil.WriteFile("docs/design.md", []byte(md), 0644)
+*/
+package notemarkdown
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+
+	ynote "github.com/youdao-api/go-ynote"
+)
+
+var md = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithRendererOptions(
+		renderer.WithNodeRenderers(
+			// Before the checkbox renderer of extension.TaskList (500)
+			util.Prioritized(taskCheckBoxRenderer{}, 100),
+		),
+		// Raw HTML is kept, and the output is sanitized instead.
+		html.WithUnsafe(),
+	),
+)
+
+/*
+	Convert converts the Markdown source to note HTML. Images with a relative
+	path are read from the local file system, relative to dir, and uploaded
+	via s. If s is nil, they are left as they are.
+
+	Raw HTML in the Markdown is kept, e.g. the <u> or <span style> written by
+	Export, except scripts, forms, embedded frames and objects, event handler
+	attributes and javascript: URLs, which are removed.
+
+	Absolute paths, file: URLs and paths leading out of dir, e.g. through ..
+	or a symbolic link, are left as they are too, so converting untrusted
+	Markdown does not upload other local files.
+*/
+func Convert(ctx context.Context, s ynote.NoteService, dir string, source []byte) (string, error) {
+	_, source = SplitFrontMatter(source)
+	doc := md.Parser().Parse(text.NewReader(source))
+
+	if s != nil {
+		if err := uploadImages(ctx, s, dir, doc); err != nil {
+			return "", err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := md.Renderer().Render(&buf, source, doc); err != nil {
+		return "", err
+	}
+	return sanitize(buf.String()), nil
+}
+
+/*
+	FrontMatter is the metadata of a note in the YAML front matter of a
+	Markdown document, as written by Export.
+*/
+type FrontMatter struct {
+	Title  string
+	Author string
+	Source string
+}
+
+/*
+	SplitFrontMatter returns the front matter at the start of source, between
+	two --- lines, and the Markdown after it. If there is none, nil and
+	source are returned.
+
+	Only the title, author and source keys with plain, single-quoted or
+	double-quoted scalar values are read; other YAML is ignored.
+*/
+func SplitFrontMatter(source []byte) (*FrontMatter, []byte) {
+	lines := strings.SplitAfter(string(source), "\n")
+	if len(lines) == 0 || !isDelimiter(lines[0]) {
+		return nil, source
+	}
+
+	fm := &FrontMatter{}
+	offset := len(lines[0])
+	for _, line := range lines[1:] {
+		offset += len(line)
+		if isDelimiter(line) || strings.TrimRight(line, " \t\r\n") == "..." {
+			return fm, source[offset:]
+		}
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		val := yamlScalar(strings.TrimSpace(kv[1]))
+		switch strings.TrimSpace(kv[0]) {
+		case "title":
+			fm.Title = val
+		case "author":
+			fm.Author = val
+		case "source":
+			fm.Source = val
+		}
+	}
+	// Not closed, so it is not front matter.
+	return nil, source
+}
+
+func isDelimiter(line string) bool {
+	return strings.TrimRight(line, " \t\r\n") == "---"
+}
+
+/* yamlScalar returns the value of a flow scalar on one line. */
+func yamlScalar(s string) string {
+	switch {
+	case len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"':
+		// Common escapes are the same in Go and YAML.
+		if v, err := strconv.Unquote(s); err == nil {
+			return v
+		}
+		return s[1 : len(s)-1]
+	case len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'':
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+	// A comment ends a plain scalar.
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s
+}
+
+/*
+	localPath returns the file in dir an image destination refers to, or ""
+	if it is not a relative path of a file in dir.
+*/
+func localPath(dir, dest string) string {
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return ""
+	}
+	// u.Path is unescaped, e.g. %20 is a space.
+	p := filepath.FromSlash(u.Path)
+	if filepath.IsAbs(p) || filepath.VolumeName(p) != "" {
+		return ""
+	}
+	p = filepath.Join(dir, p)
+	if !within(dir, p) {
+		return ""
+	}
+	// Symbolic links are followed when reading the file.
+	if rdir, err := filepath.EvalSymlinks(dir); err == nil {
+		if rp, err := filepath.EvalSymlinks(p); err == nil && !within(rdir, rp) {
+			return ""
+		}
+	}
+	return p
+}
+
+/* within reports whether p is in the directory dir. */
+func within(dir, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != ".." &&
+		!strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+/*
+	uploadImages uploads the local images of doc and replaces their
+	destinations with the uploaded URLs. An image referenced more than once
+	is uploaded once.
+*/
+func uploadImages(ctx context.Context, s ynote.NoteService, dir string, doc ast.Node) error {
+	var images []*ast.Image
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if img, ok := n.(*ast.Image); ok && entering {
+			images = append(images, img)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	uploaded := make(map[string]string)
+	for _, img := range images {
+		fn := localPath(dir, string(img.Destination))
+		if fn == "" {
+			continue
+		}
+		u, ok := uploaded[fn]
+		if !ok {
+			ai, err := s.UploadAttachmentContext(ctx, fn)
+			if err != nil {
+				return err
+			}
+			u = ai.URL
+			uploaded[fn] = u
+		}
+		img.Destination = []byte(u)
+	}
+	return nil
+}
+
+/*
+	taskCheckBoxRenderer renders the checkbox of a task list item as a
+	character, since notes do not show form inputs.
+*/
+type taskCheckBoxRenderer struct{}
+
+func (taskCheckBoxRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(extast.KindTaskCheckBox, func(w util.BufWriter, source []byte,
+		n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		if n.(*extast.TaskCheckBox).IsChecked {
+			w.WriteString("☑ ")
+		} else {
+			w.WriteString("☐ ")
+		}
+		return ast.WalkContinue, nil
+	})
+}
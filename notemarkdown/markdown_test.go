@@ -0,0 +1,125 @@
+package notemarkdown
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/youdao-api/go-ynote/ynotetest"
+)
+
+func TestConvert(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	dir := t.TempDir()
+	png := []byte("\x89PNG\r\n\x1a\n0000000000000")
+	if err := os.MkdirAll(filepath.Join(dir, "img"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "img", "a b.png"), png, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	src := "# Title\n\n| a | b |\n|---|:-:|\n| 1 | 2 |\n\n- [x] done\n- [ ] todo\n\n" +
+		"![x](img/a%20b.png) ![y](<img/a b.png>) ![r](http://e.com/x.png)\n\n~~s~~ https://e.com\n"
+	out, err := Convert(context.Background(), srv.Client(), dir, []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<h1>Title</h1>", "<table>", `<th style="text-align:center">b</th>`,
+		"☑ done", "☐ todo", "<del>s</del>", `<a href="https://e.com">https://e.com</a>`,
+		`src="http://e.com/x.png"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("%s not in %s", want, out)
+		}
+	}
+	// The image referenced twice is uploaded once.
+	prefix := srv.URL + "/yws/open/resource/download/"
+	if n := strings.Count(out, prefix); n != 2 {
+		t.Errorf("%d uploaded images in %s, want 2", n, out)
+	}
+	u := out[strings.Index(out, prefix):]
+	u = u[:strings.IndexByte(u, '"')]
+	if got := srv.Resource(u); string(got) != string(png) {
+		t.Errorf("uploaded %q, want %q", got, png)
+	}
+}
+
+func TestConvertFrontMatter(t *testing.T) {
+	src := "---\ntitle: \"Design \\\"v2\\\"\"\nauthor: 'O''Neil'\nsource: http://e.com/a # origin\ntags: [a, b]\n---\n\n# Heading\n"
+	fm, body := SplitFrontMatter([]byte(src))
+	want := FrontMatter{Title: `Design "v2"`, Author: "O'Neil", Source: "http://e.com/a"}
+	if fm == nil || *fm != want {
+		t.Errorf("SplitFrontMatter: %+v, want %+v", fm, want)
+	}
+	if string(body) != "\n# Heading\n" {
+		t.Errorf("body %q", body)
+	}
+
+	out, err := Convert(context.Background(), nil, "", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "<h1>Heading</h1>\n" {
+		t.Errorf("Convert: %q", out)
+	}
+
+	for _, src := range []string{"# No front matter\n", "---\ntitle: not closed\n", "text\n---\n"} {
+		if fm, body := SplitFrontMatter([]byte(src)); fm != nil || string(body) != src {
+			t.Errorf("SplitFrontMatter(%q): %+v, %q", src, fm, body)
+		}
+	}
+}
+
+func TestConvertRawHTML(t *testing.T) {
+	src := "<u>under</u> <span style=\"color:red\">red</span> H<sub>2</sub>O\n\n" +
+		"<div onclick=\"steal()\">div</div>\n\n" +
+		"<script>steal()</script>\n\n" +
+		"[link](javascript:steal()) <a href=\" JaVaScRiPt:steal()\">a</a> <iframe src=\"http://e.com/\"></iframe>\n"
+	out, err := Convert(context.Background(), nil, "", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<u>under</u>", `<span style="color:red">red</span>`, "<sub>2</sub>", "<div>div</div>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("%s not in %s", want, out)
+		}
+	}
+	for _, unsafe := range []string{"steal", "iframe", "script"} {
+		if strings.Contains(out, unsafe) {
+			t.Errorf("%s in %s", unsafe, out)
+		}
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	dir := t.TempDir()
+	d := filepath.Join(dir, "d")
+	if err := os.Mkdir(d, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(d, "a.png"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/etc/passwd", filepath.Join(d, "link.png")); err != nil {
+		t.Fatal(err)
+	}
+
+	for dest, ok := range map[string]bool{
+		"a.png": true, "./a.png": true, "sub/../a.png": true,
+		"/etc/passwd": false, "file:///etc/passwd": false, "../x.png": false,
+		"a/../../x.png": false, "link.png": false, "http://e.com/a.png": false,
+		"%2e%2e/x.png": false,
+	} {
+		if got := localPath(d, dest) != ""; got != ok {
+			t.Errorf("localPath(%q) is local: %v, want %v", dest, got, ok)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package notemarkdown
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+/* Elements removed with their content by sanitize */
+var unsafeElements = map[atom.Atom]bool{
+	atom.Applet: true, atom.Base: true, atom.Button: true, atom.Embed: true,
+	atom.Form: true, atom.Frame: true, atom.Frameset: true, atom.Iframe: true,
+	atom.Input: true, atom.Link: true, atom.Meta: true, atom.Object: true,
+	atom.Script: true, atom.Select: true, atom.Style: true, atom.Textarea: true,
+}
+
+/* Attributes holding URLs */
+var urlAttributes = map[string]bool{
+	"action": true, "background": true, "cite": true, "formaction": true,
+	"href": true, "poster": true, "src": true,
+}
+
+/*
+	sanitize removes the unsafe elements, event handler attributes and
+	script URLs from the HTML h.
+*/
+func sanitize(h string) string {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(h), body)
+	if err != nil {
+		// Only errors reading h are returned.
+		return ""
+	}
+
+	var sb strings.Builder
+	for _, n := range nodes {
+		if sanitizeNode(n) {
+			html.Render(&sb, n)
+		}
+	}
+	return sb.String()
+}
+
+/* sanitizeNode sanitizes n in place, returning false if n is removed. */
+func sanitizeNode(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return true
+	}
+	if unsafeElements[n.DataAtom] {
+		return false
+	}
+
+	attr := n.Attr[:0]
+	for _, a := range n.Attr {
+		key := strings.ToLower(a.Key)
+		if strings.HasPrefix(key, "on") || urlAttributes[key] && isScriptURL(a.Val) {
+			continue
+		}
+		attr = append(attr, a)
+	}
+	n.Attr = attr
+
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if !sanitizeNode(c) {
+			n.RemoveChild(c)
+		}
+		c = next
+	}
+	return true
+}
+
+/* isScriptURL reports whether u runs script, e.g. a javascript: URL. */
+func isScriptURL(u string) bool {
+	// Browsers ignore whitespace and control characters in URLs.
+	u = strings.ToLower(strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, u))
+	return strings.HasPrefix(u, "javascript:") || strings.HasPrefix(u, "vbscript:") ||
+		strings.HasPrefix(u, "data:") && !strings.HasPrefix(u, "data:image/")
+}
@@ -0,0 +1,151 @@
+package notemerge
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+/*
+	A block is a top-level node of some HTML content: an element with all its
+	children, a comment, or a run of text.
+*/
+type block struct {
+	// The source of the block, including the whitespace following it
+	raw string
+	// The source, trimmed, used for comparing blocks
+	key string
+
+	// For an element, the tag name, the source of the start tag, of the
+	// children and of the end tag. close is empty if there is no end tag.
+	tag         string
+	open, inner string
+	close       string
+}
+
+func (b *block) isElement() bool {
+	return b.tag != ""
+}
+
+/* Elements without end tags */
+var voidElements = map[atom.Atom]bool{
+	atom.Area: true, atom.Base: true, atom.Br: true, atom.Col: true,
+	atom.Embed: true, atom.Hr: true, atom.Img: true, atom.Input: true,
+	atom.Link: true, atom.Meta: true, atom.Param: true, atom.Source: true,
+	atom.Track: true, atom.Wbr: true,
+}
+
+/*
+	splitBlocks splits content into its top-level blocks. The source of the
+	blocks concatenated is content, except that whitespace before the first
+	block is dropped.
+
+	The content is tokenized rather than parsed, so that the blocks keep their
+	source as it is. End tags implied by HTML parsing rules (e.g. of a <p>
+	followed by another <p>) are not recognized, so such content ends up in
+	fewer, larger blocks, which merges less finely but still correctly.
+*/
+func splitBlocks(content string) []*block {
+	var blocks []*block
+	var cur *block
+	var sb, inner strings.Builder
+	depth := 0
+
+	flush := func() {
+		if cur == nil {
+			return
+		}
+		cur.raw = sb.String()
+		cur.key = strings.TrimSpace(cur.raw)
+		if cur.isElement() && cur.close != "" {
+			cur.inner = inner.String()
+		}
+		blocks = append(blocks, cur)
+		cur = nil
+		sb.Reset()
+		inner.Reset()
+	}
+
+	z := html.NewTokenizer(strings.NewReader(content))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			// io.EOF; the tokenizer does not fail on malformed content.
+			break
+		}
+		raw := string(z.Raw())
+
+		if depth > 0 {
+			switch tt {
+			case html.StartTagToken:
+				if name, _ := z.TagName(); !voidElements[atom.Lookup(name)] {
+					depth++
+				}
+			case html.EndTagToken:
+				depth--
+			}
+			if depth == 0 {
+				cur.close = raw
+			} else {
+				inner.WriteString(raw)
+			}
+			sb.WriteString(raw)
+			continue
+		}
+
+		if tt == html.TextToken && strings.TrimSpace(raw) == "" {
+			// Whitespace between blocks goes with the preceding one.
+			if len(blocks) > 0 && cur == nil {
+				last := blocks[len(blocks)-1]
+				last.raw += raw
+			} else if cur != nil {
+				sb.WriteString(raw)
+			}
+			continue
+		}
+
+		if tt == html.TextToken && cur != nil && !cur.isElement() {
+			// Adjacent text, e.g. split at an entity
+			sb.WriteString(raw)
+			continue
+		}
+
+		flush()
+		cur = &block{}
+		sb.WriteString(raw)
+		switch tt {
+		case html.StartTagToken:
+			name, _ := z.TagName()
+			cur.tag = string(name)
+			cur.open = raw
+			if !voidElements[atom.Lookup(name)] {
+				depth = 1
+				continue
+			}
+			flush()
+		case html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			cur.tag = string(name)
+			cur.open = raw
+			flush()
+		case html.TextToken:
+			// Text may be continued by following text tokens.
+		default:
+			// Comments, doctypes and stray end tags are blocks of their own.
+			flush()
+		}
+	}
+	flush()
+
+	return blocks
+}
+
+/* joinBlocks returns the source of blocks. */
+func joinBlocks(blocks []*block) string {
+	var sb strings.Builder
+	for _, b := range blocks {
+		sb.WriteString(b.raw)
+	}
+	return sb.String()
+}
@@ -0,0 +1,254 @@
+/*
+	Package notemerge merges concurrent edits of the HTML content of a note.
+
+	Merge does a three-way merge of a local and a remote version of the content
+	against the base version both are edited from, e.g. after UpdateNoteIf
+	reports an *ynote.ErrConflict:
+
+		merged, conflicts := notemerge.Merge(base.Content, local.Content,
+			conflict.Note.Content)
+		if conflicts == 0 {
+			err = yc.UpdateNoteIf(path, conflict.Current, local.Title,
+				local.Author, local.Source, merged)
+		}
+
+	The content is compared block by block, a block being a top-level element
+	with all its children, a comment or a run of text. Blocks changed on only
+	one side are taken from that side. If both sides changed the same block of
+	an element with the same tag, e.g. different items of a list, the children
+	are merged the same way. Otherwise both versions are kept in a conflict
+	block:
+
+		<div class="ynote-merge-conflict">
+		<div class="ynote-merge-local">...</div>
+		<div class="ynote-merge-remote">...</div>
+		</div>
+
+	which shows both versions in the note for the user to resolve.
+*/
+package notemerge
+
+import (
+	"strings"
+)
+
+/* CSS classes of the conflict blocks emitted by Merge */
+const (
+	ConflictClass = "ynote-merge-conflict"
+	LocalClass    = "ynote-merge-local"
+	RemoteClass   = "ynote-merge-remote"
+)
+
+/*
+	Merge merges the changes from base to local and from base to remote. It
+	returns the merged content and the number of conflict blocks in it.
+*/
+func Merge(base, local, remote string) (merged string, conflicts int) {
+	if local == remote || remote == base {
+		return local, 0
+	}
+	if local == base {
+		return remote, 0
+	}
+
+	m := &merger{}
+	merged = m.merge(splitBlocks(base), splitBlocks(local), splitBlocks(remote))
+	return merged, m.conflicts
+}
+
+/*
+	HasConflicts returns whether content contains conflict blocks emitted by
+	Merge, i.e. whether a merged content still needs to be resolved.
+*/
+func HasConflicts(content string) bool {
+	return strings.Contains(content, `class="`+ConflictClass+`"`)
+}
+
+type merger struct {
+	conflicts int
+}
+
+func (m *merger) merge(base, local, remote []*block) string {
+	ml, mr := match(base, local), match(base, remote)
+
+	var sb strings.Builder
+	i, j, k := 0, 0, 0
+	for {
+		// Blocks unchanged on both sides
+		for i < len(base) && j < len(local) && k < len(remote) &&
+			ml[i] == j && mr[i] == k {
+			raw := local[j].raw
+			if trailingSpace(raw) == "" {
+				// e.g. the last local block followed by remote additions
+				raw += trailingSpace(remote[k].raw)
+			}
+			sb.WriteString(raw)
+			i, j, k = i+1, j+1, k+1
+		}
+		if i == len(base) && j == len(local) && k == len(remote) {
+			break
+		}
+
+		// Find the next base block kept on both sides.
+		o := i
+		for o < len(base) && (ml[o] < 0 || mr[o] < 0) {
+			o++
+		}
+		jj, kk := len(local), len(remote)
+		if o < len(base) {
+			jj, kk = ml[o], mr[o]
+		}
+
+		sb.WriteString(m.mergeChunk(base[i:o], local[j:jj], remote[k:kk]))
+		i, j, k = o, jj, kk
+	}
+
+	return sb.String()
+}
+
+/* mergeChunk merges a run of blocks changed on one side or both. */
+func (m *merger) mergeChunk(base, local, remote []*block) string {
+	switch {
+	case sameBlocks(local, base):
+		return joinBlocks(remote)
+	case sameBlocks(remote, base), sameBlocks(local, remote):
+		return joinBlocks(local)
+	}
+
+	// Adjacent blocks changed on different sides, or elements changed on both
+	// sides, are merged block by block if the sides still line up.
+	if len(local) == len(base) && len(remote) == len(base) {
+		var sb strings.Builder
+		ok := true
+		for i := 0; ok && i < len(base); i++ {
+			var merged string
+			merged, ok = m.mergeBlock(base[i], local[i], remote[i])
+			sb.WriteString(merged)
+		}
+		if ok {
+			return sb.String()
+		}
+	}
+
+	m.conflicts++
+	var trailing string
+	if len(local) > 0 {
+		trailing = trailingSpace(local[len(local)-1].raw)
+	}
+	return conflictBlock(joinBlocks(local), joinBlocks(remote)) + trailing
+}
+
+/* mergeBlock merges a block without conflicts if possible. */
+func (m *merger) mergeBlock(base, local, remote *block) (string, bool) {
+	switch {
+	case local.key == base.key:
+		return remote.raw, true
+	case remote.key == base.key, local.key == remote.key:
+		return local.raw, true
+	}
+	return m.mergeElement(base, local, remote)
+}
+
+/*
+	mergeElement merges the children of an element changed on both sides,
+	if the element is still the same one, i.e. it has the same tag and its
+	attributes are not changed on both sides, and the changes of the children
+	do not conflict.
+*/
+func (*merger) mergeElement(base, local, remote *block) (string, bool) {
+	if !base.isElement() || base.close == "" ||
+		local.tag != base.tag || remote.tag != base.tag ||
+		local.close == "" || remote.close == "" {
+		return "", false
+	}
+
+	open := local.open
+	switch {
+	case local.open == base.open:
+		open = remote.open
+	case remote.open == base.open, remote.open == local.open:
+	default:
+		return "", false
+	}
+
+	// Conflict blocks are kept at the top level, where a <div> is valid, so
+	// a conflict among the children is a conflict of the element.
+	sub := &merger{}
+	inner := sub.merge(splitBlocks(base.inner), splitBlocks(local.inner),
+		splitBlocks(remote.inner))
+	if sub.conflicts > 0 {
+		return "", false
+	}
+
+	// Keep the whitespace following the element on the local side.
+	return open + inner + local.close + trailingSpace(local.raw), true
+}
+
+func conflictBlock(local, remote string) string {
+	return `<div class="` + ConflictClass + `">` +
+		`<div class="` + LocalClass + `">` + local + `</div>` +
+		`<div class="` + RemoteClass + `">` + remote + `</div>` +
+		`</div>`
+}
+
+func trailingSpace(raw string) string {
+	return raw[len(strings.TrimRightFunc(raw, isSpace)):]
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f'
+}
+
+func sameBlocks(a, b []*block) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].key != b[i].key {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+	match returns, for every block of base, the index of the matching block
+	in other, or -1 if it is removed in other. The matching is a longest
+	common subsequence of the blocks.
+*/
+func match(base, other []*block) []int {
+	n, m := len(base), len(other)
+	// lcs[i][j] is the length of the LCS of base[i:] and other[j:].
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if base[i].key == other[j].key {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	res := make([]int, n)
+	for i := range res {
+		res[i] = -1
+	}
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case base[i].key == other[j].key:
+			res[i] = j
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return res
+}
@@ -0,0 +1,79 @@
+package notemerge
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name                string
+		base, local, remote string
+		want                string
+		conflicts           int
+	}{{
+		name:   "unchanged remotely",
+		base:   "<p>a</p>",
+		local:  "<p>A</p>",
+		remote: "<p>a</p>",
+		want:   "<p>A</p>",
+	}, {
+		name:   "unchanged locally",
+		base:   "<p>a</p>",
+		local:  "<p>a</p>",
+		remote: "<p>A</p>",
+		want:   "<p>A</p>",
+	}, {
+		name:   "different blocks",
+		base:   "<p>a</p>\n<p>b</p>\n<ul><li>x</li><li>y</li></ul>\n<p>c</p>",
+		local:  "<p>A</p>\n<p>b</p>\n<ul><li>X</li><li>y</li></ul>\n<p>c</p>",
+		remote: "<p>a</p>\n<p>b</p>\n<ul><li>x</li><li>Y</li></ul>\n<p>c</p>\n<p>d</p>",
+		want:   "<p>A</p>\n<p>b</p>\n<ul><li>X</li><li>Y</li></ul>\n<p>c</p>\n<p>d</p>",
+	}, {
+		name:   "nested blocks",
+		base:   "<div><p>a</p><p>b</p></div>",
+		local:  "<div><p>a1</p><p>b</p></div>",
+		remote: "<div><p>a</p><p>b1</p></div>",
+		want:   "<div><p>a1</p><p>b1</p></div>",
+	}, {
+		name:   "same change",
+		base:   "<p>a</p>\n<p>b</p>",
+		local:  "<p>A</p>\n<p>b</p>",
+		remote: "<p>A</p>\n<p>b</p>",
+		want:   "<p>A</p>\n<p>b</p>",
+	}}
+	for _, test := range tests {
+		got, conflicts := Merge(test.base, test.local, test.remote)
+		if got != test.want || conflicts != test.conflicts {
+			t.Errorf("%s: Merge() = %q, %d; want %q, %d", test.name, got,
+				conflicts, test.want, test.conflicts)
+		}
+		if HasConflicts(got) {
+			t.Errorf("%s: HasConflicts(%q) = true", test.name, got)
+		}
+	}
+}
+
+func TestMergeConflict(t *testing.T) {
+	got, conflicts := Merge("<p>a</p>\n<p>b</p>", "<p>a1</p>\n<p>b</p>",
+		"<p>a2</p>\n<p>b</p>")
+	if conflicts != 1 || !HasConflicts(got) {
+		t.Fatalf("Merge() = %q, %d; want 1 conflict", got, conflicts)
+	}
+	for _, s := range []string{"a1", "a2", LocalClass, RemoteClass, "<p>b</p>"} {
+		if !strings.Contains(got, s) {
+			t.Errorf("Merge() = %q, missing %q", got, s)
+		}
+	}
+}
+
+func TestSplitBlocks(t *testing.T) {
+	for _, s := range []string{
+		"", "text", "<p>a<p>b", "a &amp; b<!-- c --></x><p/>",
+		"<div><p>a</p>\n<p>b</p></div>\n<ul><li>x</li></ul>",
+	} {
+		if got := joinBlocks(splitBlocks(s)); got != s {
+			t.Errorf("joinBlocks(splitBlocks(%q)) = %q", s, got)
+		}
+	}
+}
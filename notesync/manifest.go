@@ -0,0 +1,131 @@
+package notesync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/* The name of the manifest file in the synced directory */
+const ManifestFile = ".ynotesync.json"
+
+/*
+	The extension of the files of notes. A file contains the HTML content of
+	a note, and its name without the extension is the title of the note.
+*/
+const NoteExt = ".html"
+
+/* manifest is the state of the notes as of the last sync. */
+type manifest struct {
+	// Notebook directories (relative to the synced directory) by notebook
+	// paths
+	Notebooks map[string]string `json:"notebooks"`
+	// Notes by note paths
+	Notes map[string]*entry `json:"notes"`
+}
+
+/* entry is the state of a note, as of the last sync. */
+type entry struct {
+	// Path of the notebook
+	Notebook string `json:"notebook"`
+	// Name of the file in the notebook directory
+	File string `json:"file"`
+	// The title of the note, which the name of the file may differ from
+	Title string `json:"title"`
+	// The version of the note, ModifyTime in seconds
+	ModifyTime int64 `json:"modify_time"`
+	Size       int64 `json:"size"`
+	// The SHA-256 of the file
+	Hash string `json:"hash"`
+}
+
+func loadManifest(fn string) (*manifest, error) {
+	m := &manifest{}
+	js, err := ioutil.ReadFile(fn)
+	if err == nil {
+		err = json.Unmarshal(js, m)
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Notebooks == nil {
+		m.Notebooks = make(map[string]string)
+	}
+	if m.Notes == nil {
+		m.Notes = make(map[string]*entry)
+	}
+	return m, nil
+}
+
+/* save writes the manifest atomically, so a failed sync keeps the last one. */
+func (m *manifest) save(fn string) error {
+	js, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := fn + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(js, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fn)
+}
+
+func hashOf(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+/*
+	sanitize returns a file name for a title or a notebook name, replacing
+	characters not allowed in file names on common systems.
+*/
+func sanitize(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	// Names starting with a dot are hidden, and ending with one invalid on
+	// Windows.
+	name = strings.Trim(name, " .")
+	if len(name) > 200 {
+		name = name[:200]
+		for !utf8.ValidString(name) {
+			name = name[:len(name)-1]
+		}
+	}
+	if name == "" {
+		name = "untitled"
+	}
+	return name
+}
+
+/*
+	uniqueName returns name, or name with a number appended, not in used and
+	not existing in dir.
+*/
+func uniqueName(dir, name, ext string, used map[string]bool) string {
+	fn := name + ext
+	for i := 2; used[fn] || exists(filepath.Join(dir, fn)); i++ {
+		fn = name + " (" + strconv.Itoa(i) + ")" + ext
+	}
+	used[fn] = true
+	return fn
+}
+
+func exists(fn string) bool {
+	_, err := os.Lstat(fn)
+	return err == nil
+}
@@ -0,0 +1,571 @@
+/*
+	Package notesync synchronizes notebooks with a local directory in both
+	directions.
+
+		sy := notesync.New(yc, "notes")
+		report, err := sy.Sync(ctx)
+		...
+		for _, c := range report.Conflicts {
+			fmt.Println("Conflict:", c)
+		}
+
+	Every notebook is mirrored to a sub-directory named after it, and every
+	note of it to a file named after the title of the note, with extension
+	NoteExt, containing the HTML content of the note. Characters not allowed
+	in file names are replaced and a number is appended to a name taken, but
+	the title is only changed when the file is renamed. The state of the last
+	sync, i.e. the title, modification time and size of every note and a hash
+	of its file, is kept in ManifestFile in the directory, so that a sync
+	finds out what changed on either side since:
+
+	  - A note created, changed or deleted on one side is created, changed
+	    or deleted on the other side. Renaming a file changes the title.
+	  - A directory created locally is created as a notebook.
+	  - A note changed on both sides, or changed on one side and deleted on
+	    the other, is reported as a Conflict and left alone on both sides.
+	    It is synced again once either side is changed back or deleted.
+
+	Notebooks deleted remotely are handled as deleting all their notes, but
+	deleting a directory locally does not delete the notebook, which is
+	mirrored again instead. Only the title and the content are synced; the
+	author and source are kept as they are.
+*/
+package notesync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	ynote "github.com/youdao-api/go-ynote"
+)
+
+/* Op is the kind of a Change made by a sync. */
+type Op int
+
+const (
+	// A note is created locally.
+	CreateLocal Op = iota
+	// A local file is updated from its note.
+	UpdateLocal
+	// A local file is deleted since its note is deleted.
+	DeleteLocal
+	// A note is created from a local file.
+	CreateRemote
+	// A note is updated from its local file.
+	UpdateRemote
+	// A note is deleted since its local file is deleted.
+	DeleteRemote
+	// A notebook is created for a local directory.
+	CreateNotebook
+)
+
+var opNames = [...]string{"create local", "update local", "delete local",
+	"create remote", "update remote", "delete remote", "create notebook"}
+
+func (op Op) String() string {
+	if op < 0 || int(op) >= len(opNames) {
+		return fmt.Sprintf("Op(%d)", int(op))
+	}
+	return opNames[op]
+}
+
+/* Change is a change made by a sync. */
+type Change struct {
+	Op Op
+	// Path of the note, or of the notebook for CreateNotebook
+	Path string
+	// The file, or the directory for CreateNotebook, relative to the synced
+	// directory
+	File string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%v: %s (%s)", c.Op, c.File, c.Path)
+}
+
+/* Reasons of conflicts */
+const (
+	BothChanged               = "changed on both sides"
+	LocalChangedRemoteDeleted = "changed locally, deleted remotely"
+	RemoteChangedLocalDeleted = "changed remotely, deleted locally"
+)
+
+/* Conflict is a note a sync left alone because of conflicting changes. */
+type Conflict struct {
+	// Path of the note
+	Path string
+	// The file relative to the synced directory
+	File string
+	// One of BothChanged, LocalChangedRemoteDeleted and
+	// RemoteChangedLocalDeleted
+	Reason string
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s (%s): %s", c.File, c.Path, c.Reason)
+}
+
+/* Report is the result of a sync. */
+type Report struct {
+	Changes   []Change
+	Conflicts []Conflict
+}
+
+/* Syncer synchronizes the notebooks of a NoteService with a directory. */
+type Syncer struct {
+	s   ynote.NoteService
+	dir string
+}
+
+/* New returns a Syncer of the notebooks of s with directory dir. */
+func New(s ynote.NoteService, dir string) *Syncer {
+	return &Syncer{s: s, dir: dir}
+}
+
+/*
+	Sync synchronizes the notebooks with the directory once. The report lists
+	what is changed, also if an error is returned; the manifest is saved in
+	any case, so a later sync picks up where a failed one stopped.
+*/
+func (sy *Syncer) Sync(ctx context.Context) (report *Report, err error) {
+	if err := os.MkdirAll(sy.dir, 0755); err != nil {
+		return nil, err
+	}
+	mfn := filepath.Join(sy.dir, ManifestFile)
+	m, err := loadManifest(mfn)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &state{sy: sy, ctx: ctx, m: m, report: &Report{}}
+	defer func() {
+		if serr := m.save(mfn); err == nil {
+			err = serr
+		}
+	}()
+
+	return st.report, st.sync()
+}
+
+/* state is the state of a running sync. */
+type state struct {
+	sy     *Syncer
+	ctx    context.Context
+	m      *manifest
+	report *Report
+}
+
+func (st *state) change(op Op, path, file string) {
+	st.report.Changes = append(st.report.Changes, Change{Op: op, Path: path, File: file})
+}
+
+func (st *state) conflict(path, file, reason string) {
+	st.report.Conflicts = append(st.report.Conflicts,
+		Conflict{Path: path, File: file, Reason: reason})
+}
+
+func (st *state) sync() error {
+	nbs, err := st.sy.s.ListNotebooksContext(st.ctx)
+	if err != nil {
+		return err
+	}
+
+	remote := make(map[string]bool)
+	used := make(map[string]bool)
+	for _, dir := range st.m.Notebooks {
+		used[dir] = true
+	}
+	for _, nb := range nbs {
+		remote[nb.Path] = true
+		if _, ok := st.m.Notebooks[nb.Path]; ok {
+			continue
+		}
+		// A new notebook takes a directory of the same name created locally.
+		name := sanitize(nb.Name)
+		if used[name] {
+			name = uniqueName(st.sy.dir, name, "", used)
+		}
+		used[name] = true
+		st.m.Notebooks[nb.Path] = name
+	}
+
+	// Local directories not mirroring any notebook are new notebooks.
+	fis, err := ioutil.ReadDir(st.sy.dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		if !fi.IsDir() || strings.HasPrefix(fi.Name(), ".") || used[fi.Name()] {
+			continue
+		}
+		nb, err := st.sy.s.CreateNotebookContext(st.ctx, fi.Name(), "")
+		if err != nil {
+			return err
+		}
+		st.change(CreateNotebook, nb.Path, fi.Name())
+		remote[nb.Path] = true
+		st.m.Notebooks[nb.Path] = fi.Name()
+		used[fi.Name()] = true
+	}
+
+	for _, nbPath := range sortedKeys(st.m.Notebooks) {
+		if err := st.syncNotebook(nbPath, remote[nbPath]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+/* local is a file of a note in a notebook directory. */
+type local struct {
+	content []byte
+	hash    string
+}
+
+/*
+	syncNotebook synchronizes a notebook with its directory. If the notebook
+	does not exist remotely any more, all its notes are handled as deleted.
+*/
+func (st *state) syncNotebook(nbPath string, exists bool) error {
+	rel := st.m.Notebooks[nbPath]
+	dir := filepath.Join(st.sy.dir, rel)
+
+	notes := make(map[string]*ynote.NoteInfo)
+	if exists {
+		paths, err := st.sy.s.ListNotesContext(st.ctx, nbPath)
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			ni, err := st.sy.s.NoteInfoContext(st.ctx, p)
+			if err != nil {
+				return err
+			}
+			notes[p] = ni
+		}
+		if !dirExists(dir) {
+			// Deleting a directory does not delete the notebook; pull it
+			// again.
+			for p, e := range st.m.Notes {
+				if e.Notebook == nbPath {
+					delete(st.m.Notes, p)
+				}
+			}
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	files, err := readNoteFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	ns := &notebookState{state: st, nbPath: nbPath, rel: rel, dir: dir,
+		notes: notes, files: files, claimed: make(map[string]bool)}
+	if err := ns.syncTracked(); err != nil {
+		return err
+	}
+	if err := ns.pullNew(); err != nil {
+		return err
+	}
+	if exists {
+		return ns.pushNew()
+	}
+
+	// Forget the notebook once nothing of it is left. New files left make
+	// the directory a new notebook in the next sync.
+	for _, e := range st.m.Notes {
+		if e.Notebook == nbPath {
+			return nil
+		}
+	}
+	delete(st.m.Notebooks, nbPath)
+	os.Remove(dir)
+	return nil
+}
+
+func dirExists(dir string) bool {
+	fi, err := os.Stat(dir)
+	return err == nil && fi.IsDir()
+}
+
+/* readNoteFiles returns the files of notes in dir by name. */
+func readNoteFiles(dir string) (map[string]*local, error) {
+	files := make(map[string]*local)
+	fis, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return files, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fi := range fis {
+		if !fi.Mode().IsRegular() || filepath.Ext(fi.Name()) != NoteExt ||
+			strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files[fi.Name()] = &local{content: content, hash: hashOf(content)}
+	}
+	return files, nil
+}
+
+/* notebookState is the state of syncing a notebook. */
+type notebookState struct {
+	*state
+	nbPath string
+	// The directory relative to the synced one, and the full path
+	rel, dir string
+
+	// The remote notes by path, and the local files by name
+	notes map[string]*ynote.NoteInfo
+	files map[string]*local
+	// Files of the notes already handled
+	claimed map[string]bool
+}
+
+func titleOf(file string) string {
+	return strings.TrimSuffix(file, NoteExt)
+}
+
+func (ns *notebookState) relFile(file string) string {
+	return filepath.ToSlash(filepath.Join(ns.rel, file))
+}
+
+/* track records the current state of a note and its file. */
+func (ns *notebookState) track(path, file string, ni *ynote.NoteInfo, hash string) {
+	ns.m.Notes[path] = &entry{
+		Notebook:   ns.nbPath,
+		File:       file,
+		Title:      ni.Title,
+		ModifyTime: ni.ModifyTime.Unix(),
+		Size:       ni.Size,
+		Hash:       hash,
+	}
+	ns.claimed[file] = true
+}
+
+func (e *entry) changed(ni *ynote.NoteInfo) bool {
+	return ni.ModifyTime.Unix() != e.ModifyTime || ni.Size != e.Size
+}
+
+/* syncTracked synchronizes the notes synced before. */
+func (ns *notebookState) syncTracked() error {
+	var paths []string
+	for p, e := range ns.m.Notes {
+		if e.Notebook == ns.nbPath {
+			paths = append(paths, p)
+			ns.claimed[e.File] = true
+		}
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		if err := ns.syncNote(p, ns.m.Notes[p]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ns *notebookState) syncNote(p string, e *entry) error {
+	ni, remote := ns.notes[p]
+	f, exists := ns.files[e.File]
+	localChanged := exists && f.hash != e.Hash
+	remoteChanged := remote && e.changed(ni)
+	fn := filepath.Join(ns.dir, e.File)
+
+	switch {
+	case !remote && !exists:
+		delete(ns.m.Notes, p)
+
+	case !remote && localChanged:
+		ns.conflict(p, ns.relFile(e.File), LocalChangedRemoteDeleted)
+
+	case !remote:
+		if err := os.Remove(fn); err != nil {
+			return err
+		}
+		delete(ns.m.Notes, p)
+		ns.change(DeleteLocal, p, ns.relFile(e.File))
+
+	case !exists && remoteChanged:
+		ns.conflict(p, ns.relFile(e.File), RemoteChangedLocalDeleted)
+
+	case !exists:
+		if renamed := ns.findRenamed(e.Hash); renamed != "" {
+			return ns.push(p, renamed, titleOf(renamed), ni, ns.files[renamed])
+		}
+		if err := ns.sy.s.DeleteNoteContext(ns.ctx, p); err != nil {
+			return err
+		}
+		delete(ns.m.Notes, p)
+		delete(ns.notes, p)
+		ns.change(DeleteRemote, p, ns.relFile(e.File))
+
+	case localChanged && remoteChanged:
+		if hashOf([]byte(ni.Content)) == f.hash && ni.Title == e.Title {
+			// Changed the same way
+			ns.track(p, e.File, ni, f.hash)
+			break
+		}
+		ns.conflict(p, ns.relFile(e.File), BothChanged)
+
+	case localChanged:
+		return ns.push(p, e.File, ni.Title, ni, f)
+
+	case remoteChanged:
+		return ns.pull(p, e, ni)
+	}
+	return nil
+}
+
+/*
+	findRenamed returns the name of a new file with the content hash, i.e.
+	the file of a note is renamed, or "" if there is none.
+*/
+func (ns *notebookState) findRenamed(hash string) string {
+	var names []string
+	for name, f := range ns.files {
+		if !ns.claimed[name] && f.hash == hash {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+/*
+	push updates the note at p from a file, with title. ni is the note fetched
+	at the start of the sync; if it has been changed since, it is a conflict.
+*/
+func (ns *notebookState) push(p, file, title string, ni *ynote.NoteInfo, f *local) error {
+	err := ynote.UpdateServiceNoteIf(ns.ctx, ns.sy.s, p, ni.Version(), title,
+		ni.Author, ni.Source, string(f.content))
+	if errors.Is(err, ynote.ErrNoteModified) {
+		// The file of a renamed note is kept with the note, not pushed as a
+		// new one.
+		ns.m.Notes[p].File = file
+		ns.claimed[file] = true
+		ns.conflict(p, ns.relFile(file), BothChanged)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	ni, err = ns.sy.s.NoteInfoContext(ns.ctx, p)
+	if err != nil {
+		return err
+	}
+	ns.track(p, file, ni, f.hash)
+	ns.change(UpdateRemote, p, ns.relFile(file))
+	return nil
+}
+
+/*
+	pull updates the file of the note at p, tracked as e, renaming it if the
+	title has changed.
+*/
+func (ns *notebookState) pull(p string, e *entry, ni *ynote.NoteInfo) error {
+	file, newFile := e.File, e.File
+	if ni.Title != e.Title && titleOf(file) != sanitize(ni.Title) {
+		newFile = uniqueName(ns.dir, sanitize(ni.Title), NoteExt, ns.claimed)
+	}
+
+	content := []byte(ni.Content)
+	if err := ioutil.WriteFile(filepath.Join(ns.dir, newFile), content, 0644); err != nil {
+		return err
+	}
+	if newFile != file {
+		if err := os.Remove(filepath.Join(ns.dir, file)); err != nil {
+			return err
+		}
+	}
+	ns.track(p, newFile, ni, hashOf(content))
+	ns.change(UpdateLocal, p, ns.relFile(newFile))
+	return nil
+}
+
+/* pullNew creates the files of the notes not synced before. */
+func (ns *notebookState) pullNew() error {
+	var paths []string
+	for p := range ns.notes {
+		if _, ok := ns.m.Notes[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		ni := ns.notes[p]
+		content := []byte(ni.Content)
+		hash := hashOf(content)
+
+		// A new local file identical to the new note, e.g. of a sync
+		// interrupted before saving the manifest, is the note's file.
+		name := sanitize(ni.Title) + NoteExt
+		if f, ok := ns.files[name]; ok && !ns.claimed[name] && f.hash == hash {
+			ns.track(p, name, ni, hash)
+			continue
+		}
+
+		name = uniqueName(ns.dir, sanitize(ni.Title), NoteExt, ns.claimed)
+		if err := ioutil.WriteFile(filepath.Join(ns.dir, name), content, 0644); err != nil {
+			return err
+		}
+		ns.track(p, name, ni, hash)
+		ns.change(CreateLocal, p, ns.relFile(name))
+	}
+	return nil
+}
+
+/* pushNew creates notes of the files not synced before. */
+func (ns *notebookState) pushNew() error {
+	var names []string
+	for name := range ns.files {
+		if !ns.claimed[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := ns.files[name]
+		p, err := ns.sy.s.CreateNoteContext(ns.ctx, ns.nbPath, titleOf(name), "",
+			"", string(f.content))
+		if err != nil {
+			return err
+		}
+		ni, err := ns.sy.s.NoteInfoContext(ns.ctx, p)
+		if err != nil {
+			return err
+		}
+		ns.track(p, name, ni, f.hash)
+		ns.change(CreateRemote, p, ns.relFile(name))
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package notesync
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	ynote "github.com/youdao-api/go-ynote"
+	"github.com/youdao-api/go-ynote/ynotetest"
+)
+
+/* newServer returns a fake server whose clock advances a second per change. */
+func newServer() *ynotetest.Server {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	now := time.Unix(1000000000, 0)
+	srv.Now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	return srv
+}
+
+func syncOnce(t *testing.T, sy *Syncer) *Report {
+	t.Helper()
+	r, err := sy.Sync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func ops(r *Report) map[Op]int {
+	res := make(map[Op]int)
+	for _, c := range r.Changes {
+		res[c.Op]++
+	}
+	return res
+}
+
+func writeFile(t *testing.T, fn, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fn, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, fn string) string {
+	t.Helper()
+	content, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func noteInfo(t *testing.T, yc *ynote.YnoteClient, p string) *ynote.NoteInfo {
+	t.Helper()
+	ni, err := yc.NoteInfo(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ni
+}
+
+func TestSync(t *testing.T) {
+	srv := newServer()
+	defer srv.Close()
+	yc := srv.Client()
+	dir := t.TempDir()
+	nb, _ := yc.CreateNotebook("Work/Stuff", "")
+	hello, _ := yc.CreateNote(nb.Path, "Hello", "me", "", "<p>hi</p>")
+	bye, _ := yc.CreateNote(nb.Path, "Bye", "me", "", "<p>bye</p>")
+	nbDir := filepath.Join(dir, "Work_Stuff")
+
+	sy := New(yc, dir)
+	if r := syncOnce(t, sy); ops(r)[CreateLocal] != 2 || len(r.Changes) != 2 {
+		t.Fatalf("first sync: %v", r.Changes)
+	}
+	if got := readFile(t, filepath.Join(nbDir, "Hello.html")); got != "<p>hi</p>" {
+		t.Errorf("Hello.html = %q", got)
+	}
+	if r := syncOnce(t, sy); len(r.Changes) != 0 {
+		t.Fatalf("sync without changes: %v", r.Changes)
+	}
+
+	// Changes on both sides, of different notes
+	writeFile(t, filepath.Join(nbDir, "Hello.html"), "<p>hi2</p>")
+	yc.UpdateNote(bye, "Bye", "me", "", "<p>bye2</p>")
+	writeFile(t, filepath.Join(nbDir, "New.html"), "<p>new</p>")
+	writeFile(t, filepath.Join(dir, "Home", "H.html"), "<p>h</p>")
+	r := syncOnce(t, sy)
+	want := map[Op]int{UpdateRemote: 1, UpdateLocal: 1, CreateRemote: 2, CreateNotebook: 1}
+	if got := ops(r); !reflect.DeepEqual(got, want) {
+		t.Fatalf("changes: %v, want %v", r.Changes, want)
+	}
+	if ni := noteInfo(t, yc, hello); ni.Content != "<p>hi2</p>" || ni.Author != "me" {
+		t.Errorf("pushed note: %+v", ni)
+	}
+	if got := readFile(t, filepath.Join(nbDir, "Bye.html")); got != "<p>bye2</p>" {
+		t.Errorf("pulled Bye.html = %q", got)
+	}
+
+	// Renaming the file changes the title.
+	if err := os.Rename(filepath.Join(nbDir, "Hello.html"),
+		filepath.Join(nbDir, "Hello World.html")); err != nil {
+		t.Fatal(err)
+	}
+	if r := syncOnce(t, sy); len(r.Changes) != 1 {
+		t.Fatalf("rename: %v", r.Changes)
+	}
+	if ni := noteInfo(t, yc, hello); ni.Title != "Hello World" {
+		t.Errorf("renamed note: %+v", ni)
+	}
+
+	// Changing the title renames the file.
+	yc.UpdateNote(hello, "Hi", "me", "", "<p>hi2</p>")
+	syncOnce(t, sy)
+	if got := readFile(t, filepath.Join(nbDir, "Hi.html")); got != "<p>hi2</p>" {
+		t.Errorf("Hi.html = %q", got)
+	}
+
+	// Deleting on one side deletes on the other.
+	if err := os.Remove(filepath.Join(nbDir, "Bye.html")); err != nil {
+		t.Fatal(err)
+	}
+	yc.DeleteNote(hello)
+	if r := syncOnce(t, sy); ops(r)[DeleteRemote] != 1 || ops(r)[DeleteLocal] != 1 {
+		t.Fatalf("deletes: %v", r.Changes)
+	}
+	if _, err := yc.NoteInfo(bye); err == nil {
+		t.Error("note of the deleted file is not deleted")
+	}
+	if _, err := os.Stat(filepath.Join(nbDir, "Hi.html")); !os.IsNotExist(err) {
+		t.Errorf("file of the deleted note: %v", err)
+	}
+
+	// A deleted directory is pulled again.
+	if err := os.RemoveAll(nbDir); err != nil {
+		t.Fatal(err)
+	}
+	if r := syncOnce(t, sy); len(r.Changes) != 1 || r.Changes[0].Op != CreateLocal {
+		t.Fatalf("deleted directory: %v", r.Changes)
+	}
+
+	// A deleted notebook deletes the directory.
+	yc.DeleteNotebook(nb.Path)
+	syncOnce(t, sy)
+	if _, err := os.Stat(nbDir); !os.IsNotExist(err) {
+		t.Errorf("directory of the deleted notebook: %v", err)
+	}
+	if r := syncOnce(t, sy); len(r.Changes) != 0 {
+		t.Fatalf("sync without changes: %v", r.Changes)
+	}
+}
+
+func TestSyncConflict(t *testing.T) {
+	srv := newServer()
+	defer srv.Close()
+	yc := srv.Client()
+	dir := t.TempDir()
+	nb, _ := yc.CreateNotebook("nb", "")
+	p, _ := yc.CreateNote(nb.Path, "Note", "", "", "<p>a</p>")
+	fn := filepath.Join(dir, "nb", "Note.html")
+
+	sy := New(yc, dir)
+	syncOnce(t, sy)
+
+	writeFile(t, fn, "<p>local</p>")
+	yc.UpdateNote(p, "Note", "", "", "<p>remote</p>")
+	r := syncOnce(t, sy)
+	if len(r.Changes) != 0 || len(r.Conflicts) != 1 || r.Conflicts[0].Reason != BothChanged {
+		t.Fatalf("report: %v, %v", r.Changes, r.Conflicts)
+	}
+	if got := readFile(t, fn); got != "<p>local</p>" {
+		t.Errorf("file changed to %q", got)
+	}
+	if ni := noteInfo(t, yc, p); ni.Content != "<p>remote</p>" {
+		t.Errorf("note changed to %q", ni.Content)
+	}
+
+	// Changed back to the same content, it is resolved.
+	writeFile(t, fn, "<p>remote</p>")
+	if r := syncOnce(t, sy); len(r.Conflicts) != 0 || len(r.Changes) != 0 {
+		t.Fatalf("report: %v, %v", r.Changes, r.Conflicts)
+	}
+}
+
+func TestSyncModifiedWhilePushing(t *testing.T) {
+	srv := newServer()
+	defer srv.Close()
+	yc := srv.Client()
+	dir := t.TempDir()
+	nb, _ := yc.CreateNotebook("nb", "")
+	p, _ := yc.CreateNote(nb.Path, "Note", "", "", "<p>a</p>")
+	fn := filepath.Join(dir, "nb", "Note.html")
+
+	// The note is changed by others after it is fetched.
+	modify := false
+	s := ynote.NewInterceptedService(yc, func(ctx context.Context, op string, call func(ctx context.Context) error) error {
+		err := call(ctx)
+		if modify && op == "NoteInfo" {
+			modify = false
+			yc.UpdateNote(p, "Note", "", "", "<p>remote</p>")
+		}
+		return err
+	})
+	sy := New(s, dir)
+	syncOnce(t, sy)
+
+	writeFile(t, fn, "<p>local</p>")
+	modify = true
+	r := syncOnce(t, sy)
+	if len(r.Changes) != 0 || len(r.Conflicts) != 1 || r.Conflicts[0].Reason != BothChanged {
+		t.Fatalf("report: %v, %v", r.Changes, r.Conflicts)
+	}
+	if ni := noteInfo(t, yc, p); ni.Content != "<p>remote</p>" {
+		t.Errorf("note overwritten with %q", ni.Content)
+	}
+	if r := syncOnce(t, sy); len(r.Conflicts) != 1 {
+		t.Errorf("conflict not reported again: %v, %v", r.Changes, r.Conflicts)
+	}
+}
+
+func TestSyncTitles(t *testing.T) {
+	srv := newServer()
+	defer srv.Close()
+	yc := srv.Client()
+	dir := t.TempDir()
+	nb, _ := yc.CreateNotebook("nb", "")
+	q, _ := yc.CreateNote(nb.Path, "Q&A: why?", "", "", "<p>q</p>")
+	dup1, _ := yc.CreateNote(nb.Path, "Dup", "", "", "<p>1</p>")
+	dup2, _ := yc.CreateNote(nb.Path, "Dup", "", "", "<p>2</p>")
+	nbDir := filepath.Join(dir, "nb")
+
+	sy := New(yc, dir)
+	syncOnce(t, sy)
+
+	// A title not valid as a file name is kept when the file is pushed.
+	writeFile(t, filepath.Join(nbDir, "Q&A_ why_.html"), "<p>q2</p>")
+	syncOnce(t, sy)
+	if ni := noteInfo(t, yc, q); ni.Title != "Q&A: why?" || ni.Content != "<p>q2</p>" {
+		t.Errorf("pushed note: %+v", ni)
+	}
+
+	// Files of notes of the same title keep their names.
+	files := map[string]string{dup1: "nb/Dup.html", dup2: "nb/Dup (2).html"}
+	if dup1 > dup2 {
+		files[dup1], files[dup2] = files[dup2], files[dup1]
+	}
+	for i := 0; i < 2; i++ {
+		yc.UpdateNote(dup1, "Dup", "", "", "<p>1</p>"+strings.Repeat("!", i+1))
+		yc.UpdateNote(dup2, "Dup", "", "", "<p>2</p>"+strings.Repeat("!", i+1))
+		r := syncOnce(t, sy)
+		if len(r.Changes) != 2 {
+			t.Errorf("changes: %v", r.Changes)
+		}
+		for _, c := range r.Changes {
+			if c.Op != UpdateLocal || c.File != files[c.Path] {
+				t.Errorf("change %v, want updating %s", c, files[c.Path])
+			}
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package ynote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+/*
+	ErrNoteModified is matched, by errors.Is, by the *ErrConflict returned by
+	PatchNote and UpdateNoteIf when the note has been modified since the
+	version the changes are based on.
+*/
+var ErrNoteModified = errors.New("ynote: note modified since it was read")
+
+/*
+	NoteVersion identifies a version of a note. The modification time is in
+	seconds, so the size is compared as well to catch changes within the same
+	second.
+*/
+type NoteVersion struct {
+	ModifyTime time.Time
+	Size       int64
+}
+
+/* Version returns the version of the note. */
+func (ni *NoteInfo) Version() NoteVersion {
+	return NoteVersion{ModifyTime: ni.ModifyTime, Size: ni.Size}
+}
+
+func (v NoteVersion) equal(o NoteVersion) bool {
+	return v.ModifyTime.Equal(o.ModifyTime) && v.Size == o.Size
+}
+
+/* String returns the version, without the size if it is zero, i.e. unknown. */
+func (v NoteVersion) String() string {
+	if v.Size == 0 {
+		return v.ModifyTime.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%s/%d bytes", v.ModifyTime.Format(time.RFC3339), v.Size)
+}
+
+/*
+	ErrConflict is returned by a conditional update if the note has been
+	modified since the version the caller started from. It matches
+	ErrNoteModified with errors.Is.
+*/
+type ErrConflict struct {
+	// Path of the note
+	Path string
+	// The version the update was based on. Its Size is zero, i.e. unknown, if
+	// only the modification time was given, as by NotePatch.ModifyTime.
+	Base NoteVersion
+	// The current version of the note
+	Current NoteVersion
+	// The current note, e.g. for merging the changes
+	Note *NoteInfo
+}
+
+func (e *ErrConflict) Error() string {
+	return fmt.Sprintf("ynote: note %s modified: based on %v, now %v", e.Path,
+		e.Base, e.Current)
+}
+
+/* Is makes errors.Is(err, ErrNoteModified) true. */
+func (e *ErrConflict) Is(target error) bool {
+	return target == ErrNoteModified
+}
+
+/*
+	NotePatch specifies the fields of a note PatchNote changes. A nil field is
+	left as it is.
+*/
+type NotePatch struct {
+	Title   *string
+	Author  *string
+	Source  *string
+	Content *string
+
+	// If not zero, the patch is applied only if the modification time of the
+	// note still equals ModifyTime, e.g. the NoteInfo.ModifyTime the changes
+	// are based on. Otherwise an *ErrConflict is returned. Use UpdateNoteIf
+	// to check the size as well.
+	ModifyTime time.Time
+}
+
+/* String returns a pointer to s, a helper for filling a NotePatch. */
+func String(s string) *string {
+	return &s
+}
+
+/* complete returns whether the patch specifies every field of a note. */
+func (p *NotePatch) complete() bool {
+	return p.Title != nil && p.Author != nil && p.Source != nil && p.Content != nil
+}
+
+/*
+	PatchNote changes the fields of a note specified in patch only. Since the
+	open API updates all the fields at once, the current note is fetched
+	first unless patch specifies every field and no ModifyTime.
+
+	The ModifyTime check is done on the fetched note, so an update by others
+	between the fetch and the update is not detected.
+*/
+func (yc *YnoteClient) PatchNote(path string, patch NotePatch) error {
+	return yc.PatchNoteContext(context.Background(), path, patch)
+}
+
+/*
+	PatchNoteContext is like PatchNote but the requests are bound to ctx.
+*/
+func (yc *YnoteClient) PatchNoteContext(ctx context.Context, path string, patch NotePatch) error {
+	return PatchServiceNote(ctx, yc, path, patch)
+}
+
+/*
+	PatchServiceNote is like PatchNoteContext but for any NoteService, e.g. a
+	decorated one.
+*/
+func PatchServiceNote(ctx context.Context, s NoteService, path string, patch NotePatch) error {
+	if patch.complete() && patch.ModifyTime.IsZero() {
+		return s.UpdateNoteContext(ctx, path, *patch.Title, *patch.Author,
+			*patch.Source, *patch.Content)
+	}
+
+	ni, err := s.NoteInfoContext(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	if !patch.ModifyTime.IsZero() && !ni.ModifyTime.Equal(patch.ModifyTime) {
+		return &ErrConflict{
+			Path:    path,
+			Base:    NoteVersion{ModifyTime: patch.ModifyTime},
+			Current: ni.Version(),
+			Note:    ni,
+		}
+	}
+
+	title, author, source, content := ni.Title, ni.Author, ni.Source, ni.Content
+	if patch.Title != nil {
+		title = *patch.Title
+	}
+	if patch.Author != nil {
+		author = *patch.Author
+	}
+	if patch.Source != nil {
+		source = *patch.Source
+	}
+	if patch.Content != nil {
+		content = *patch.Content
+	}
+
+	return s.UpdateNoteContext(ctx, path, title, author, source, content)
+}
+
+/*
+	UpdateNoteIf is like UpdateNote but only updates the note if it is still
+	at version, e.g. the Version() of the NoteInfo the changes are based on.
+	The note is read again right before writing and an *ErrConflict is
+	returned if it differs.
+
+	The open API has no conditional update, so an update by others between
+	the read and the write is still not detected.
+*/
+func (yc *YnoteClient) UpdateNoteIf(path string, version NoteVersion, title, author, source, content string) error {
+	return yc.UpdateNoteIfContext(context.Background(), path, version, title, author, source, content)
+}
+
+/*
+	UpdateNoteIfContext is like UpdateNoteIf but the requests are bound to ctx.
+*/
+func (yc *YnoteClient) UpdateNoteIfContext(ctx context.Context, path string, version NoteVersion, title, author, source, content string) error {
+	return UpdateServiceNoteIf(ctx, yc, path, version, title, author, source, content)
+}
+
+/*
+	UpdateServiceNoteIf is like UpdateNoteIfContext but for any NoteService,
+	e.g. a decorated one.
+*/
+func UpdateServiceNoteIf(ctx context.Context, s NoteService, path string, version NoteVersion, title, author, source, content string) error {
+	ni, err := s.NoteInfoContext(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	if cur := ni.Version(); !cur.equal(version) {
+		return &ErrConflict{Path: path, Base: version, Current: cur, Note: ni}
+	}
+
+	return s.UpdateNoteContext(ctx, path, title, author, source, content)
+}
@@ -0,0 +1,171 @@
+package ynote_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	ynote "github.com/youdao-api/go-ynote"
+	"github.com/youdao-api/go-ynote/ynotetest"
+)
+
+/* tickingServer returns a fake server whose clock advances a second per change. */
+func tickingServer() *ynotetest.Server {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	now := time.Unix(1000000000, 0)
+	srv.Now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	return srv
+}
+
+/* createNote creates a note in a new notebook, returning its path. */
+func createNote(t *testing.T, yc *ynote.YnoteClient) string {
+	t.Helper()
+	nb, err := yc.CreateNotebook("nb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := yc.CreateNote(nb.Path, "title", "author", "source", "<p>content</p>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPatchNote(t *testing.T) {
+	srv := tickingServer()
+	defer srv.Close()
+	yc := srv.Client()
+	path := createNote(t, yc)
+
+	if err := yc.PatchNote(path, ynote.NotePatch{Title: ynote.String("new title")}); err != nil {
+		t.Fatal(err)
+	}
+	ni := srv.Note(path)
+	if ni.Title != "new title" || ni.Author != "author" || ni.Source != "source" ||
+		ni.Content != "<p>content</p>" {
+		t.Errorf("patched note: %+v", ni)
+	}
+
+	// A complete patch without ModifyTime needs no fetch.
+	requests := srv.Requests()
+	err := yc.PatchNote(path, ynote.NotePatch{
+		Title:   ynote.String("t"),
+		Author:  ynote.String("a"),
+		Source:  ynote.String("s"),
+		Content: ynote.String("c"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Requests() - requests; n != 1 {
+		t.Errorf("complete patch sent %d requests, want 1", n)
+	}
+	if ni := srv.Note(path); ni.Title != "t" || ni.Content != "c" {
+		t.Errorf("patched note: %+v", ni)
+	}
+}
+
+func TestPatchNoteModified(t *testing.T) {
+	srv := tickingServer()
+	defer srv.Close()
+	yc := srv.Client()
+	path := createNote(t, yc)
+
+	ni, err := yc.NoteInfo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := yc.UpdateNote(path, "by others", "", "", "<p>theirs</p>"); err != nil {
+		t.Fatal(err)
+	}
+
+	err = yc.PatchNote(path, ynote.NotePatch{
+		Title:      ynote.String("mine"),
+		ModifyTime: ni.ModifyTime,
+	})
+	if !errors.Is(err, ynote.ErrNoteModified) {
+		t.Fatalf("PatchNote of a modified note: %v, want ErrNoteModified", err)
+	}
+	var conflict *ynote.ErrConflict
+	if !errors.As(err, &conflict) || conflict.Note == nil || conflict.Note.Title != "by others" {
+		t.Errorf("conflict: %+v", conflict)
+	}
+	if !conflict.Base.ModifyTime.Equal(ni.ModifyTime) || conflict.Base.Size != 0 {
+		t.Errorf("conflict based on %v, want %v with an unknown size", conflict.Base, ni.ModifyTime)
+	}
+	if ni := srv.Note(path); ni.Title != "by others" {
+		t.Errorf("note changed to %q", ni.Title)
+	}
+
+	// Based on the current version, the patch applies.
+	err = yc.PatchNote(path, ynote.NotePatch{
+		Title:      ynote.String("mine"),
+		ModifyTime: conflict.Note.ModifyTime,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ni := srv.Note(path); ni.Title != "mine" || ni.Content != "<p>theirs</p>" {
+		t.Errorf("patched note: %+v", ni)
+	}
+}
+
+func TestPatchServiceNote(t *testing.T) {
+	srv := tickingServer()
+	defer srv.Close()
+	yc := srv.Client()
+	path := createNote(t, yc)
+
+	ctx := context.Background()
+	patch := ynote.NotePatch{Title: ynote.String("new title")}
+	err := ynote.PatchServiceNote(ctx, ynote.NewReadOnlyService(yc), path, patch)
+	if !errors.Is(err, ynote.ErrReadOnly) {
+		t.Errorf("PatchServiceNote of a read-only service: %v, want ErrReadOnly", err)
+	}
+	if err := ynote.PatchServiceNote(ctx, yc, path, patch); err != nil {
+		t.Fatal(err)
+	}
+	if ni := srv.Note(path); ni.Title != "new title" {
+		t.Errorf("patched title: %q", ni.Title)
+	}
+}
+
+func TestUpdateNoteIf(t *testing.T) {
+	srv := tickingServer()
+	defer srv.Close()
+	yc := srv.Client()
+	path := createNote(t, yc)
+
+	ni, err := yc.NoteInfo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := ni.Version()
+	if err := yc.UpdateNote(path, "by others", "", "", "<p>theirs</p>"); err != nil {
+		t.Fatal(err)
+	}
+
+	err = yc.UpdateNoteIf(path, base, "mine", "", "", "<p>mine</p>")
+	var conflict *ynote.ErrConflict
+	if !errors.As(err, &conflict) || !errors.Is(err, ynote.ErrNoteModified) {
+		t.Fatalf("UpdateNoteIf of a modified note: %v, want an *ErrConflict", err)
+	}
+	cur := srv.Note(path).Version()
+	if conflict.Path != path || conflict.Base != base || conflict.Current != cur {
+		t.Errorf("conflict: %+v, want based on %v, now %v", conflict, base, cur)
+	}
+	if ni := srv.Note(path); ni.Title != "by others" {
+		t.Errorf("note changed to %q", ni.Title)
+	}
+
+	if err := yc.UpdateNoteIf(path, cur, "mine", "", "", "<p>mine</p>"); err != nil {
+		t.Fatal(err)
+	}
+	if ni := srv.Note(path); ni.Title != "mine" {
+		t.Errorf("updated title: %q", ni.Title)
+	}
+}
@@ -0,0 +1,183 @@
+package ynote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* EndpointFamily groups the API endpoints sharing a rate limit. */
+type EndpointFamily string
+
+const (
+	// /yws/open/user/*
+	UserEndpoints EndpointFamily = "user"
+	// /yws/open/notebook/*
+	NotebookEndpoints EndpointFamily = "notebook"
+	// /yws/open/note/*
+	NoteEndpoints EndpointFamily = "note"
+	// /yws/open/resource/*, including downloading attachments
+	ResourceEndpoints EndpointFamily = "resource"
+)
+
+/*
+	ErrRateLimited is returned (possibly wrapped) when a call is rejected by a
+	fail-fast RateLimit.
+*/
+var ErrRateLimited = errors.New("ynote: client-side rate limit exceeded")
+
+/* RateLimit is the configuration of a token-bucket rate limiter. */
+type RateLimit struct {
+	// Sustained number of calls per second. Zero or negative means no limit.
+	Rate float64
+	// Maximum number of calls in a burst. Values less than 1 are treated as 1.
+	Burst int
+	// If set, a call fails with ErrRateLimited instead of waiting when the
+	// budget is exhausted.
+	FailFast bool
+}
+
+/*
+	RateLimitHook is called when a call to an endpoint of family has to wait
+	for wait before being issued. For fail-fast limits, it is called with the
+	wait that would have been needed, before the call is rejected.
+*/
+type RateLimitHook func(family EndpointFamily, wait time.Duration)
+
+/*
+	WithRateLimit limits the rate of calls to the endpoints of family. Every
+	attempt of a retried call consumes the budget. If limit.Rate is not
+	positive, calls to the endpoints of family are not limited.
+*/
+func WithRateLimit(family EndpointFamily, limit RateLimit) Option {
+	return func(yc *YnoteClient) {
+		if !(limit.Rate > 0) {
+			delete(yc.limiters, family)
+			return
+		}
+		if yc.limiters == nil {
+			yc.limiters = make(map[EndpointFamily]*tokenBucket)
+		}
+		yc.limiters[family] = newTokenBucket(limit)
+	}
+}
+
+/* WithRateLimitHook sets the hook reporting waits caused by rate limits. */
+func WithRateLimitHook(hook RateLimitHook) Option {
+	return func(yc *YnoteClient) {
+		yc.rateLimitHook = hook
+	}
+}
+
+/*
+	familyOf returns the EndpointFamily of an API URL, i.e. the segment after
+	/yws/open/. Returns "" for other URLs.
+*/
+func familyOf(urlStr string) EndpointFamily {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return ""
+	}
+	const prefix = "/yws/open/"
+	idx := strings.Index(u.Path, prefix)
+	if idx < 0 {
+		return ""
+	}
+	family := u.Path[idx+len(prefix):]
+	if idx := strings.Index(family, "/"); idx >= 0 {
+		family = family[:idx]
+	}
+	return EndpointFamily(family)
+}
+
+/*
+	waitRateLimit blocks until the rate limit of family allows another call, or
+	returns an error if ctx is done or the limit is fail-fast and exhausted.
+*/
+func (yc *YnoteClient) waitRateLimit(ctx context.Context, family EndpointFamily) error {
+	tb := yc.limiters[family]
+	if tb == nil {
+		return nil
+	}
+
+	wait, ok := tb.reserve(time.Now())
+	if wait <= 0 {
+		return nil
+	}
+	if yc.rateLimitHook != nil {
+		yc.rateLimitHook(family, wait)
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s endpoints, retry after %v", ErrRateLimited, family, wait)
+	}
+
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		tb.cancel()
+		return ctx.Err()
+	}
+}
+
+/* tokenBucket is a token-bucket rate limiter safe for concurrent use. */
+type tokenBucket struct {
+	limit RateLimit
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return &tokenBucket{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+	}
+}
+
+/*
+	reserve takes a token at now and returns how long the caller has to wait
+	before using it. For fail-fast limits, no token is taken if the caller
+	would have to wait, and ok is false.
+*/
+func (tb *tokenBucket) reserve(now time.Time) (wait time.Duration, ok bool) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	if !tb.last.IsZero() {
+		tb.tokens += now.Sub(tb.last).Seconds() * tb.limit.Rate
+		if burst := float64(tb.limit.Burst); tb.tokens > burst {
+			tb.tokens = burst
+		}
+	}
+	tb.last = now
+
+	if tb.tokens >= 1 {
+		tb.tokens--
+		return 0, true
+	}
+	wait = time.Duration((1 - tb.tokens) / tb.limit.Rate * float64(time.Second))
+	if tb.limit.FailFast {
+		return wait, false
+	}
+	// Go into debt, later callers wait for this one.
+	tb.tokens--
+	return wait, true
+}
+
+/* cancel returns a token taken by a reservation that was not used. */
+func (tb *tokenBucket) cancel() {
+	tb.mu.Lock()
+	tb.tokens++
+	tb.mu.Unlock()
+}
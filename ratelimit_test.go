@@ -0,0 +1,97 @@
+package ynote_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	ynote "github.com/youdao-api/go-ynote"
+	"github.com/youdao-api/go-ynote/ynotetest"
+)
+
+/* waitRecorder records the waits reported to a RateLimitHook. */
+type waitRecorder struct {
+	mu    sync.Mutex
+	waits map[ynote.EndpointFamily][]time.Duration
+}
+
+func (wr *waitRecorder) hook(family ynote.EndpointFamily, wait time.Duration) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	if wr.waits == nil {
+		wr.waits = make(map[ynote.EndpointFamily][]time.Duration)
+	}
+	wr.waits[family] = append(wr.waits[family], wait)
+}
+
+func TestRateLimitWaits(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	var wr waitRecorder
+	yc := srv.Client(
+		ynote.WithRateLimit(ynote.NotebookEndpoints, ynote.RateLimit{Rate: 50, Burst: 2}),
+		ynote.WithRateLimitHook(wr.hook))
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if _, err := yc.ListNotebooks(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The burst of 2 is free, the other 2 calls wait 20ms each.
+	if d := time.Since(start); d < 30*time.Millisecond {
+		t.Errorf("4 calls took %v, want at least 30ms", d)
+	}
+	if n := len(wr.waits[ynote.NotebookEndpoints]); n != 2 {
+		t.Errorf("%d waits reported, want 2", n)
+	}
+
+	// Other families are not limited.
+	for i := 0; i < 4; i++ {
+		if _, err := yc.UserInfo(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(wr.waits[ynote.UserEndpoints]); n != 0 {
+		t.Errorf("%d waits reported for user endpoints, want 0", n)
+	}
+}
+
+func TestRateLimitFailFast(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	var wr waitRecorder
+	yc := srv.Client(
+		ynote.WithRateLimit(ynote.UserEndpoints, ynote.RateLimit{Rate: 0.01, FailFast: true}),
+		ynote.WithRateLimitHook(wr.hook))
+
+	if _, err := yc.UserInfo(); err != nil {
+		t.Fatal(err)
+	}
+	before := srv.Requests()
+	if _, err := yc.UserInfo(); !errors.Is(err, ynote.ErrRateLimited) {
+		t.Fatalf("UserInfo: %v, want ErrRateLimited", err)
+	}
+	if n := srv.Requests() - before; n != 0 {
+		t.Errorf("%d requests after the limit, want 0", n)
+	}
+	if waits := wr.waits[ynote.UserEndpoints]; len(waits) != 1 || waits[0] < time.Minute {
+		t.Errorf("waits reported: %v", waits)
+	}
+}
+
+func TestRateLimitNonPositiveRate(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	for _, rate := range []float64{0, -1} {
+		yc := srv.Client(
+			ynote.WithRateLimit(ynote.UserEndpoints, ynote.RateLimit{Rate: 1, FailFast: true}),
+			ynote.WithRateLimit(ynote.UserEndpoints, ynote.RateLimit{Rate: rate, FailFast: true}))
+		for i := 0; i < 3; i++ {
+			if _, err := yc.UserInfo(); err != nil {
+				t.Fatalf("rate %v: UserInfo: %v", rate, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package ynote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+/*
+	ReauthorizeFunc gets a new access token for yc after the current one
+	expired, e.g. by calling yc.AuthorizeLocally.
+*/
+type ReauthorizeFunc func(ctx context.Context, yc *YnoteClient) (*Credentials, error)
+
+/*
+	WithReauthorize sets a function called when a call fails because the access
+	token expired. The new token is set as AccToken, saved to the token store,
+	if any, and the failed call is replayed once.
+
+	When calls from several goroutines fail at the same time, reauthorize is
+	called only once, and the other calls are replayed with the new token.
+*/
+func WithReauthorize(reauthorize ReauthorizeFunc) Option {
+	return func(yc *YnoteClient) {
+		yc.reauthorize = reauthorize
+	}
+}
+
+/* accToken returns AccToken, safe for use during a reauthorization. */
+func (yc *YnoteClient) accToken() *Credentials {
+	yc.tokenMu.RLock()
+	defer yc.tokenMu.RUnlock()
+	return yc.AccToken
+}
+
+func (yc *YnoteClient) setAccToken(token *Credentials) {
+	yc.tokenMu.Lock()
+	yc.AccToken = token
+	yc.tokenMu.Unlock()
+}
+
+func sameToken(a, b *Credentials) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+/*
+	canReauthorize reports whether a call failed with err should be replayed
+	after reauthorizing.
+*/
+func (yc *YnoteClient) canReauthorize(err error) bool {
+	return yc.reauthorize != nil && errors.Is(err, ErrTokenExpired)
+}
+
+/*
+	renewAccToken replaces the expired access token, with which a call failed,
+	with a new one from the reauthorize function, unless another goroutine has
+	done so meanwhile.
+*/
+func (yc *YnoteClient) renewAccToken(ctx context.Context, expired *Credentials) error {
+	yc.reauthMu.Lock()
+	defer yc.reauthMu.Unlock()
+
+	if !sameToken(yc.accToken(), expired) {
+		// Renewed by another call.
+		return nil
+	}
+
+	token, err := yc.reauthorize(ctx, yc)
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return errors.New("ynote: reauthorize returned no token")
+	}
+	yc.setAccToken(token)
+	return yc.saveAccToken()
+}
+
+/*
+	withReauthorize calls f, and if it fails because the access token expired,
+	renews the token and calls f again.
+*/
+func (yc *YnoteClient) withReauthorize(ctx context.Context, f func() error) error {
+	token := yc.accToken()
+	err := f()
+	if err == nil || !yc.canReauthorize(err) {
+		return err
+	}
+
+	if rerr := yc.renewAccToken(ctx, token); rerr != nil {
+		return fmt.Errorf("%w (reauthorize failed: %v)", err, rerr)
+	}
+	if rerr := f(); rerr != errNotReplayable {
+		return rerr
+	}
+	return err
+}
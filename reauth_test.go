@@ -0,0 +1,116 @@
+package ynote_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	ynote "github.com/youdao-api/go-ynote"
+	"github.com/youdao-api/go-ynote/ynotetest"
+)
+
+/* reissue returns a ReauthorizeFunc issuing tokens by srv, counting calls. */
+func reissue(srv *ynotetest.Server, calls *int32) ynote.ReauthorizeFunc {
+	return func(ctx context.Context, yc *ynote.YnoteClient) (*ynote.Credentials, error) {
+		atomic.AddInt32(calls, 1)
+		return srv.IssueToken(), nil
+	}
+}
+
+func TestReauthorize(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	var calls int32
+	store := ynote.NewFileTokenStore(t.TempDir())
+	yc := srv.Client(ynote.WithReauthorize(reissue(srv, &calls)),
+		ynote.WithTokenStore(store, "me"))
+	expired := *yc.AccToken
+
+	srv.ExpireTokens()
+	if _, err := yc.UserInfo(); err != nil {
+		t.Fatalf("UserInfo: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("reauthorized %d times, want 1", calls)
+	}
+	if *yc.AccToken == expired {
+		t.Error("AccToken not renewed")
+	}
+	if saved, err := store.Load("me"); err != nil || *saved != *yc.AccToken {
+		t.Errorf("saved token: %v, %v; want %v", saved, err, yc.AccToken)
+	}
+
+	// Downloads are replayed as well.
+	ai, err := yc.UploadAttachmentReader(context.Background(), "a.txt",
+		bytes.NewReader([]byte("hello")), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ExpireTokens()
+	var buf bytes.Buffer
+	if _, err := yc.DownloadAttachment(context.Background(), ai.URL, &buf); err != nil {
+		t.Fatalf("DownloadAttachment: %v", err)
+	}
+	if buf.String() != "hello" || calls != 2 {
+		t.Errorf("downloaded %q after %d reauthorizations", buf.String(), calls)
+	}
+}
+
+func TestReauthorizeDisabled(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	yc := srv.Client()
+
+	srv.ExpireTokens()
+	if _, err := yc.UserInfo(); !errors.Is(err, ynote.ErrTokenExpired) {
+		t.Errorf("UserInfo: %v, want ErrTokenExpired", err)
+	}
+}
+
+func TestReauthorizeFails(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	failure := errors.New("user declined")
+	yc := srv.Client(ynote.WithReauthorize(func(ctx context.Context, yc *ynote.YnoteClient) (*ynote.Credentials, error) {
+		return nil, failure
+	}))
+
+	srv.ExpireTokens()
+	_, err := yc.UserInfo()
+	if !errors.Is(err, ynote.ErrTokenExpired) {
+		t.Errorf("UserInfo: %v, want ErrTokenExpired", err)
+	}
+}
+
+func TestReauthorizeConcurrently(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	var calls int32
+	yc := srv.Client(ynote.WithReauthorize(reissue(srv, &calls)))
+
+	srv.ExpireTokens()
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := yc.ListNotebooks()
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("ListNotebooks: %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("reauthorized %d times, want 1", calls)
+	}
+}
@@ -0,0 +1,134 @@
+package ynote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+/*
+	RetryPolicy controls how failed calls are retried. Calls that only read
+	(UserInfo, ListNotebooks, ListNotes, NoteInfo) are retried on transient
+	network errors, 429 and 5xx responses which are not a FailInfo reported by
+	the service, unless the failure is an ErrQuotaExceeded, which retrying
+	does not help. A Retry-After header of the response is respected. Mutating
+	calls are retried only if RetryMutating is set.
+
+	The zero value disables retrying.
+*/
+type RetryPolicy struct {
+	// Maximum number of attempts, including the first one. Values less than 2
+	// disable retrying.
+	MaxAttempts int
+	// Backoff before the second attempt. It is doubled for every following
+	// attempt and randomized by up to a half to spread the retries.
+	InitialBackoff time.Duration
+	// Upper bound of the backoff. Zero means no bound.
+	MaxBackoff time.Duration
+	// Whether to retry mutating calls like CreateNote and UpdateNote as well.
+	// A retried mutating call may be applied twice if the response of an
+	// earlier attempt was lost.
+	RetryMutating bool
+}
+
+/* A reasonable RetryPolicy for read-only calls. */
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 200 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+}
+
+/*
+	WithRetryPolicy sets the retry policy of the client. By default, calls are
+	not retried.
+*/
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(yc *YnoteClient) {
+		yc.retryPolicy = policy
+	}
+}
+
+/* backoff returns the duration to wait after the attempt-th attempt failed. */
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+/*
+	sleep waits for the backoff of attempt, or the delay asked by the server
+	if it is longer, or until ctx is done.
+*/
+func (p *RetryPolicy) sleep(ctx context.Context, attempt int, retryAfter time.Duration) error {
+	d := p.backoff(attempt)
+	if retryAfter > d {
+		d = retryAfter
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+/*
+	shouldRetry reports whether the attempt-th attempt of r, which resulted in
+	res/js/err, should be retried.
+*/
+func (yc *YnoteClient) shouldRetry(ctx context.Context, r *apiRequest, attempt int,
+	res *http.Response, js []byte, err error) bool {
+	p := &yc.retryPolicy
+	if attempt >= p.MaxAttempts || ctx.Err() != nil {
+		return false
+	}
+	if !r.idempotent && !p.RetryMutating {
+		return false
+	}
+
+	if err != nil {
+		// Errors from the transport are wrapped in *url.Error, others (e.g.
+		// failing to open an attachment) are not transient.
+		var ue *url.Error
+		return errors.As(err, &ue)
+	}
+	return isTransientStatus(res.StatusCode, js)
+}
+
+/*
+	isTransientStatus reports whether a response with the status and body
+	indicates a transient failure. The service reports failures of a call, e.g.
+	an invalid parameter, with status 500 and a FailInfo body, which are not
+	worth retrying, and neither is an exhausted quota.
+*/
+func isTransientStatus(status int, js []byte) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		info, _ := parseFailInfo(status, js)
+		return !info.Is(ErrQuotaExceeded)
+	case http.StatusInternalServerError:
+		var failInfo struct {
+			Error string `json:"error"`
+		}
+		return json.Unmarshal(js, &failInfo) != nil || failInfo.Error == ""
+	}
+	return false
+}
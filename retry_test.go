@@ -0,0 +1,108 @@
+package ynote_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	ynote "github.com/youdao-api/go-ynote"
+	"github.com/youdao-api/go-ynote/ynotetest"
+)
+
+/* fastRetries retries quickly, so that tests don't wait. */
+var fastRetries = ynote.RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     2 * time.Millisecond,
+}
+
+func TestRetryTransient(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	yc := srv.Client(ynote.WithRetryPolicy(fastRetries))
+
+	srv.InjectFailure(ynotetest.Failure{Path: "/yws/open/notebook/all.json",
+		Times: 2, Status: http.StatusServiceUnavailable, Body: "busy"})
+	before := srv.Requests()
+	if _, err := yc.ListNotebooks(); err != nil {
+		t.Fatalf("ListNotebooks: %v", err)
+	}
+	if n := srv.Requests() - before; n != 3 {
+		t.Errorf("%d requests, want 3", n)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	yc := srv.Client(ynote.WithRetryPolicy(fastRetries))
+
+	srv.InjectFailure(ynotetest.Failure{Path: "/yws/open/notebook/all.json",
+		Status: http.StatusBadGateway, Body: "bad gateway"})
+	before := srv.Requests()
+	_, err := yc.ListNotebooks()
+	var fi *ynote.FailInfo
+	if !errors.As(err, &fi) || fi.StatusCode != http.StatusBadGateway {
+		t.Fatalf("ListNotebooks: %v, want a FailInfo with status 502", err)
+	}
+	if n := srv.Requests() - before; n != fastRetries.MaxAttempts {
+		t.Errorf("%d requests, want %d", n, fastRetries.MaxAttempts)
+	}
+}
+
+func TestRetryNotServiceFailures(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	yc := srv.Client(ynote.WithRetryPolicy(fastRetries))
+
+	// A failure reported by the service is not transient.
+	before := srv.Requests()
+	if _, err := yc.NoteInfo("/missing"); !errors.Is(err, ynote.ErrNotFound) {
+		t.Fatalf("NoteInfo: %v, want ErrNotFound", err)
+	}
+	if n := srv.Requests() - before; n != 1 {
+		t.Errorf("%d requests, want 1", n)
+	}
+}
+
+func TestRetryMutating(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	nb, err := srv.Client().CreateNotebook("nb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, retryMutating := range []bool{false, true} {
+		policy := fastRetries
+		policy.RetryMutating = retryMutating
+		yc := srv.Client(ynote.WithRetryPolicy(policy))
+
+		srv.InjectFailure(ynotetest.Failure{Path: "/yws/open/note/create.json",
+			Times: 1, Status: http.StatusServiceUnavailable})
+		before := srv.Requests()
+		_, err := yc.CreateNote(nb.Path, "title", "", "", "content")
+		if n := srv.Requests() - before; retryMutating && (err != nil || n != 2) ||
+			!retryMutating && (err == nil || n != 1) {
+			t.Errorf("RetryMutating %v: CreateNote: %v after %d requests",
+				retryMutating, err, n)
+		}
+		srv.ClearFailures()
+	}
+}
+
+func TestRetryDisabled(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	yc := srv.Client()
+
+	srv.InjectFailure(ynotetest.Failure{Status: http.StatusServiceUnavailable})
+	before := srv.Requests()
+	if _, err := yc.UserInfo(); err == nil {
+		t.Fatal("UserInfo succeeded")
+	}
+	if n := srv.Requests() - before; n != 1 {
+		t.Errorf("%d requests, want 1", n)
+	}
+}
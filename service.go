@@ -0,0 +1,33 @@
+package ynote
+
+import (
+	"context"
+	"io"
+)
+
+/*
+	NoteService is the set of user, notebook, note and resource operations of
+	the open API. *YnoteClient implements it; depend on NoteService instead to
+	allow mocking, or decorating with e.g. NewLoggingService.
+*/
+type NoteService interface {
+	UserInfoContext(ctx context.Context) (*UserInfo, error)
+
+	CreateNotebookContext(ctx context.Context, name, group string) (*NotebookInfo, error)
+	ListNotebooksContext(ctx context.Context) ([]*NotebookInfo, error)
+	DeleteNotebookContext(ctx context.Context, path string) error
+
+	CreateNoteContext(ctx context.Context, notebookPath, title, author, source, content string) (string, error)
+	ListNotesContext(ctx context.Context, notebookPath string) ([]string, error)
+	NoteInfoContext(ctx context.Context, path string) (*NoteInfo, error)
+	UpdateNoteContext(ctx context.Context, path, title, author, source, content string) error
+	DeleteNoteContext(ctx context.Context, path string) error
+	MoveNoteContext(ctx context.Context, notePath, notebookPath string) error
+
+	UploadAttachmentContext(ctx context.Context, filename string) (*AttachInfo, error)
+	UploadAttachmentReader(ctx context.Context, name string, r io.Reader, size int64) (*AttachInfo, error)
+	AuthorizeDownloadLink(link string) string
+	DownloadAttachment(ctx context.Context, link string, w io.Writer) (int64, error)
+}
+
+var _ NoteService = (*YnoteClient)(nil)
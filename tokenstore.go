@@ -0,0 +1,278 @@
+package ynote
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+/*
+	TokenStore persists access tokens keyed by an account name chosen by the
+	application.
+*/
+type TokenStore interface {
+	// Load returns the access token saved for account, or ErrNoToken if there
+	// is none.
+	Load(account string) (*Credentials, error)
+	// Save saves the access token for account, replacing any existing one.
+	Save(account string, token *Credentials) error
+	// Delete deletes the access token saved for account. It is not an error if
+	// there is none.
+	Delete(account string) error
+}
+
+/* ErrNoToken is returned by TokenStore.Load if no token is saved. */
+var ErrNoToken = errors.New("ynote: no access token saved")
+
+/*
+	WithTokenStore makes the client load its AccToken from store for account
+	when created, and save it whenever a new one is got by RequestToken or
+	AuthorizeLocally. Call LoadAccToken to get the error if the initial loading
+	fails.
+*/
+func WithTokenStore(store TokenStore, account string) Option {
+	return func(yc *YnoteClient) {
+		yc.tokenStore = store
+		yc.tokenAccount = account
+		yc.LoadAccToken()
+	}
+}
+
+/*
+	LoadAccToken sets AccToken to the token loaded from the token store. Returns
+	ErrNoToken, leaving AccToken unchanged, if none is saved.
+*/
+func (yc *YnoteClient) LoadAccToken() error {
+	if yc.tokenStore == nil {
+		return errors.New("ynote: no token store")
+	}
+	token, err := yc.tokenStore.Load(yc.tokenAccount)
+	if err != nil {
+		return err
+	}
+	yc.setAccToken(token)
+	return nil
+}
+
+/*
+	ForgetAccToken clears AccToken and deletes it from the token store, if
+	any.
+*/
+func (yc *YnoteClient) ForgetAccToken() error {
+	yc.setAccToken(nil)
+	if yc.tokenStore == nil {
+		return nil
+	}
+	return yc.tokenStore.Delete(yc.tokenAccount)
+}
+
+/* saveAccToken saves AccToken to the token store, if any. */
+func (yc *YnoteClient) saveAccToken() error {
+	token := yc.accToken()
+	if yc.tokenStore == nil || token == nil {
+		return nil
+	}
+	if err := yc.tokenStore.Save(yc.tokenAccount, token); err != nil {
+		return fmt.Errorf("ynote: saving access token: %w", err)
+	}
+	return nil
+}
+
+/*
+	tokenFiles stores the token of each account in a file under dir. Files are
+	created with permission 0600.
+*/
+type tokenFiles struct {
+	dir string
+	ext string
+}
+
+func (tf tokenFiles) path(account string) string {
+	return filepath.Join(tf.dir, url.PathEscape(account)+tf.ext)
+}
+
+func (tf tokenFiles) read(account string) ([]byte, error) {
+	data, err := ioutil.ReadFile(tf.path(account))
+	if os.IsNotExist(err) {
+		return nil, ErrNoToken
+	}
+	return data, err
+}
+
+/* write replaces the file of account atomically. */
+func (tf tokenFiles) write(account string, data []byte) error {
+	if err := os.MkdirAll(tf.dir, 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(tf.dir, ".token-")
+	if err != nil {
+		return err
+	}
+	// TempFile creates the file with 0600.
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), tf.path(account))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (tf tokenFiles) remove(account string) error {
+	err := os.Remove(tf.path(account))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+/*
+	FileTokenStore is a TokenStore saving the token of each account as a JSON
+	file named <account>.json in a directory, readable only by the owner.
+*/
+type FileTokenStore struct {
+	files tokenFiles
+}
+
+/* NewFileTokenStore returns a *FileTokenStore saving files in dir. */
+func NewFileTokenStore(dir string) *FileTokenStore {
+	return &FileTokenStore{files: tokenFiles{dir: dir, ext: ".json"}}
+}
+
+/* Implementation of TokenStore.Load */
+func (s *FileTokenStore) Load(account string) (*Credentials, error) {
+	js, err := s.files.read(account)
+	if err != nil {
+		return nil, err
+	}
+	var token Credentials
+	if err := json.Unmarshal(js, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+/* Implementation of TokenStore.Save */
+func (s *FileTokenStore) Save(account string, token *Credentials) error {
+	js, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	return s.files.write(account, js)
+}
+
+/* Implementation of TokenStore.Delete */
+func (s *FileTokenStore) Delete(account string) error {
+	return s.files.remove(account)
+}
+
+/*
+	EncryptedFileTokenStore is a TokenStore saving the token of each account as
+	a file named <account>.token in a directory, encrypted by AES-256-GCM with
+	a key derived from a passphrase by PBKDF2-SHA256. Every file has its own
+	random salt, and is bound to its account name.
+*/
+type EncryptedFileTokenStore struct {
+	files      tokenFiles
+	passphrase string
+}
+
+/*
+	NewEncryptedFileTokenStore returns a *EncryptedFileTokenStore saving files
+	in dir, encrypted with passphrase.
+*/
+func NewEncryptedFileTokenStore(dir, passphrase string) *EncryptedFileTokenStore {
+	return &EncryptedFileTokenStore{
+		files:      tokenFiles{dir: dir, ext: ".token"},
+		passphrase: passphrase,
+	}
+}
+
+const (
+	tokenFileMagic  = "YNTOKEN1"
+	tokenSaltSize   = 16
+	tokenKDFRounds  = 100000
+	tokenKeySize    = 32
+	tokenNonceSize  = 12
+	tokenHeaderSize = len(tokenFileMagic) + tokenSaltSize + tokenNonceSize
+)
+
+func (s *EncryptedFileTokenStore) aead(salt []byte) (cipher.AEAD, error) {
+	key := pbkdf2.Key([]byte(s.passphrase), salt, tokenKDFRounds, tokenKeySize, sha256.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+/* Implementation of TokenStore.Load */
+func (s *EncryptedFileTokenStore) Load(account string) (*Credentials, error) {
+	data, err := s.files.read(account)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < tokenHeaderSize || !bytes.HasPrefix(data, []byte(tokenFileMagic)) {
+		return nil, errors.New("ynote: invalid token file " + s.files.path(account))
+	}
+	salt := data[len(tokenFileMagic) : len(tokenFileMagic)+tokenSaltSize]
+	nonce := data[len(tokenFileMagic)+tokenSaltSize : tokenHeaderSize]
+
+	aead, err := s.aead(salt)
+	if err != nil {
+		return nil, err
+	}
+	js, err := aead.Open(nil, nonce, data[tokenHeaderSize:], []byte(account))
+	if err != nil {
+		return nil, errors.New("ynote: cannot decrypt token file " +
+			s.files.path(account) + ", wrong passphrase?")
+	}
+
+	var token Credentials
+	if err := json.Unmarshal(js, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+/* Implementation of TokenStore.Save */
+func (s *EncryptedFileTokenStore) Save(account string, token *Credentials) error {
+	js, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, tokenHeaderSize)
+	copy(header, tokenFileMagic)
+	if _, err := rand.Read(header[len(tokenFileMagic):]); err != nil {
+		return err
+	}
+	salt := header[len(tokenFileMagic) : len(tokenFileMagic)+tokenSaltSize]
+	nonce := header[len(tokenFileMagic)+tokenSaltSize:]
+
+	aead, err := s.aead(salt)
+	if err != nil {
+		return err
+	}
+	return s.files.write(account, aead.Seal(header, nonce, js, []byte(account)))
+}
+
+/* Implementation of TokenStore.Delete */
+func (s *EncryptedFileTokenStore) Delete(account string) error {
+	return s.files.remove(account)
+}
@@ -0,0 +1,129 @@
+package ynote_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ynote "github.com/youdao-api/go-ynote"
+	"github.com/youdao-api/go-ynote/ynotetest"
+)
+
+func TestTokenStores(t *testing.T) {
+	const account = "user@example.com/work"
+	token := &ynote.Credentials{Token: "the-token", Secret: "the-secret"}
+
+	for _, s := range []ynote.TokenStore{
+		ynote.NewFileTokenStore(t.TempDir()),
+		ynote.NewEncryptedFileTokenStore(t.TempDir(), "passphrase"),
+	} {
+		if _, err := s.Load(account); err != ynote.ErrNoToken {
+			t.Errorf("%T: Load before Save: %v, want ErrNoToken", s, err)
+		}
+		if err := s.Save(account, token); err != nil {
+			t.Fatalf("%T: Save: %v", s, err)
+		}
+		got, err := s.Load(account)
+		if err != nil || *got != *token {
+			t.Errorf("%T: Load: %v, %v; want %v", s, got, err, token)
+		}
+
+		if err := s.Delete(account); err != nil {
+			t.Errorf("%T: Delete: %v", s, err)
+		}
+		if _, err := s.Load(account); err != ynote.ErrNoToken {
+			t.Errorf("%T: Load after Delete: %v, want ErrNoToken", s, err)
+		}
+		if err := s.Delete(account); err != nil {
+			t.Errorf("%T: Delete twice: %v", s, err)
+		}
+	}
+}
+
+func TestTokenStoreFiles(t *testing.T) {
+	token := &ynote.Credentials{Token: "the-token", Secret: "the-secret"}
+	dir := t.TempDir()
+	plain := ynote.NewFileTokenStore(dir)
+	encrypted := ynote.NewEncryptedFileTokenStore(dir, "passphrase")
+	for _, s := range []ynote.TokenStore{plain, encrypted} {
+		if err := s.Save("a", token); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fis) != 2 {
+		t.Fatalf("%d files, want 2", len(fis))
+	}
+	for _, fi := range fis {
+		if fi.Mode().Perm() != 0600 {
+			t.Errorf("%s: mode %v, want 0600", fi.Name(), fi.Mode())
+		}
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "a.token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(token.Secret)) {
+		t.Error("the secret is not encrypted")
+	}
+
+	if _, err := ynote.NewEncryptedFileTokenStore(dir, "wrong").Load("a"); err == nil {
+		t.Error("Load with a wrong passphrase succeeded")
+	}
+	// A file is bound to its account.
+	if err := os.Rename(filepath.Join(dir, "a.token"), filepath.Join(dir, "b.token")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := encrypted.Load("b"); err == nil {
+		t.Error("Load of a file renamed to another account succeeded")
+	}
+}
+
+func TestWithTokenStore(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	store := ynote.NewEncryptedFileTokenStore(t.TempDir(), "passphrase")
+
+	yc := ynote.NewYnoteClient(ynotetest.Consumer, srv.URL, ynote.WithTokenStore(store, "me"))
+	if yc.AccToken != nil {
+		t.Fatalf("AccToken = %v before authorizing", yc.AccToken)
+	}
+	if _, err := yc.AuthorizeLocally(context.Background(), 10*time.Second, func(authURL string) error {
+		res, err := http.Get(authURL)
+		if err == nil {
+			res.Body.Close()
+		}
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new client loads the saved token.
+	yc2 := ynote.NewYnoteClient(ynotetest.Consumer, srv.URL, ynote.WithTokenStore(store, "me"))
+	if yc2.AccToken == nil || *yc2.AccToken != *yc.AccToken {
+		t.Fatalf("loaded AccToken = %v, want %v", yc2.AccToken, yc.AccToken)
+	}
+	if _, err := yc2.UserInfo(); err != nil {
+		t.Errorf("UserInfo with the loaded token: %v", err)
+	}
+
+	if err := yc2.ForgetAccToken(); err != nil {
+		t.Fatal(err)
+	}
+	if yc2.AccToken != nil {
+		t.Errorf("AccToken = %v after ForgetAccToken", yc2.AccToken)
+	}
+	if err := yc2.LoadAccToken(); err != ynote.ErrNoToken {
+		t.Errorf("LoadAccToken after ForgetAccToken: %v, want ErrNoToken", err)
+	}
+}
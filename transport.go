@@ -0,0 +1,148 @@
+package ynote
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+/*
+	Option configures a *YnoteClient. Options are passed to NewYnoteClient or
+	NewOnlineYnoteClient.
+*/
+type Option func(yc *YnoteClient)
+
+/*
+	Middleware wraps an http.RoundTripper with extra behavior, e.g. logging,
+	adding headers or replacing the transport with a test double.
+*/
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+/*
+	RoundTripperFunc is an adapter to allow the use of ordinary functions as
+	http.RoundTripper.
+*/
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+/* Implementation of http.RoundTripper */
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+/*
+	WithHTTPClient sets the *http.Client used for all requests, including the
+	OAuth handshake. Defaults to http.DefaultClient. The client is not modified;
+	middlewares are applied to a copy.
+*/
+func WithHTTPClient(client *http.Client) Option {
+	return func(yc *YnoteClient) {
+		yc.baseClient = client
+	}
+}
+
+/*
+	WithMiddleware appends middlewares to the chain wrapping the transport of
+	the HTTP client. The first middleware is the outermost one, i.e. it sees a
+	request first and its response last.
+*/
+func WithMiddleware(mws ...Middleware) Option {
+	return func(yc *YnoteClient) {
+		yc.middlewares = append(yc.middlewares, mws...)
+	}
+}
+
+/*
+	HeaderMiddleware returns a Middleware setting the specified headers on every
+	request.
+*/
+func HeaderMiddleware(header http.Header) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			for k, vs := range header {
+				req.Header[k] = append([]string(nil), vs...)
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+/*
+	LoggingMiddleware returns a Middleware logging the method, URL, status and
+	duration of every request to logger. If logger is nil, the standard logger
+	is used.
+*/
+func LoggingMiddleware(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.New(log.Writer(), log.Prefix(), log.Flags())
+	}
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			res, err := next.RoundTrip(req)
+			if err != nil {
+				logger.Printf("%s %s failed after %v: %v", req.Method, req.URL.Path, time.Since(start), err)
+				return nil, err
+			}
+			logger.Printf("%s %s %s in %v", req.Method, req.URL.Path, res.Status, time.Since(start))
+			return res, nil
+		})
+	}
+}
+
+/*
+	buildHTTPClient returns the client used for requests: a copy of the base
+	client whose transport is wrapped by the middleware chain.
+*/
+func (yc *YnoteClient) buildHTTPClient() *http.Client {
+	base := yc.baseClient
+	if base == nil {
+		base = http.DefaultClient
+	}
+	if len(yc.middlewares) == 0 {
+		return base
+	}
+
+	c := *base
+	transport := c.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	for i := len(yc.middlewares) - 1; i >= 0; i-- {
+		transport = yc.middlewares[i](transport)
+	}
+	c.Transport = transport
+	return &c
+}
+
+/* client returns the *http.Client used for requests. */
+func (yc *YnoteClient) client() *http.Client {
+	if yc.httpClient == nil {
+		return http.DefaultClient
+	}
+	return yc.httpClient
+}
+
+/*
+	contextClient returns a copy of client whose requests are bound to ctx. It is
+	used for calls into the oauth package, which accepts no context.
+*/
+func contextClient(ctx context.Context, client *http.Client) *http.Client {
+	c := *client
+	c.Transport = contextTransport{ctx: ctx, base: client.Transport}
+	return &c
+}
+
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req.WithContext(t.ctx))
+}
@@ -0,0 +1,104 @@
+package ynote_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	ynote "github.com/youdao-api/go-ynote"
+	"github.com/youdao-api/go-ynote/ynotetest"
+)
+
+/* plainReader hides all methods but Read, e.g. Seek. */
+type plainReader struct {
+	r *strings.Reader
+}
+
+func (pr plainReader) Read(p []byte) (int, error) {
+	return pr.r.Read(p)
+}
+
+var retryUploads = ynote.RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: fastRetries.InitialBackoff,
+	MaxBackoff:     fastRetries.MaxBackoff,
+	RetryMutating:  true,
+}
+
+const uploadPath = "/yws/open/resource/upload.json"
+
+func TestUploadAttachment(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+
+	var mu sync.Mutex
+	var done []int64
+	yc := srv.Client(ynote.WithProgress(func(name string, n, total int64) {
+		mu.Lock()
+		done = append(done, n)
+		mu.Unlock()
+		if filepath.Base(name) != "a.txt" || total != 5 {
+			t.Errorf("progress of %s: %d of %d", name, n, total)
+		}
+	}))
+
+	fn := filepath.Join(t.TempDir(), "a.txt")
+	if err := ioutil.WriteFile(fn, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ai, err := yc.UploadAttachment(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.Resource(ai.URL); string(got) != "hello" {
+		t.Errorf("uploaded %q", got)
+	}
+	if len(done) == 0 || done[len(done)-1] != 5 {
+		t.Errorf("progress reported: %v", done)
+	}
+}
+
+func TestUploadAttachmentReaderRetry(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	yc := srv.Client(ynote.WithRetryPolicy(retryUploads))
+
+	// A seekable reader is rewound for the retry.
+	srv.InjectFailure(ynotetest.Failure{Path: uploadPath, Times: 1,
+		Status: http.StatusServiceUnavailable})
+	ai, err := yc.UploadAttachmentReader(context.Background(), "a.txt",
+		bytes.NewReader([]byte("hello")), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.Resource(ai.URL); string(got) != "hello" {
+		t.Errorf("uploaded %q", got)
+	}
+}
+
+func TestUploadAttachmentReaderNotReplayable(t *testing.T) {
+	srv := ynotetest.NewServer(ynotetest.Consumer)
+	defer srv.Close()
+	yc := srv.Client(ynote.WithRetryPolicy(retryUploads))
+
+	// The content of a plain reader is consumed, so the failure of the
+	// first attempt is returned.
+	srv.InjectFailure(ynotetest.Failure{Path: uploadPath, Times: 1,
+		Status: http.StatusServiceUnavailable, Body: "busy"})
+	before := srv.Requests()
+	_, err := yc.UploadAttachmentReader(context.Background(), "a.txt",
+		plainReader{strings.NewReader("hello")}, 5)
+	var fi *ynote.FailInfo
+	if !errors.As(err, &fi) || fi.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("UploadAttachmentReader: %v, want a FailInfo with status 503", err)
+	}
+	if n := srv.Requests() - before; n != 1 {
+		t.Errorf("%d requests, want 1", n)
+	}
+}
@@ -31,13 +31,15 @@
 	3) If we read the access token from disk, Set it to the AccToken field of yc. (yc.RequestToken automatically set the field if success).
 		yc.AccToken = readAccToken()
 
-	4) Using yc's method to do operations.
+	4) Using yc's method to do operations. Each operation has a *Context
+	variant, e.g. NoteInfoContext, which accepts a context.Context for
+	cancellation and deadlines.
 
 */
 package ynote
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/garyburd/go-oauth/oauth"
@@ -45,11 +47,11 @@ import (
 	"io/ioutil"
 	//	"log"
 	"errors"
-	"mime/multipart"
 	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -66,21 +68,38 @@ type YnoteClient struct {
 	oauthClient oauth.Client
 	// The access token
 	AccToken *Credentials
+
+	retryPolicy   RetryPolicy
+	limiters      map[EndpointFamily]*tokenBucket
+	rateLimitHook RateLimitHook
+	progress      ProgressFunc
+	tokenStore    TokenStore
+	tokenAccount  string
+	reauthorize   ReauthorizeFunc
+
+	// Guards AccToken against renewing by reauthorize
+	tokenMu  sync.RWMutex
+	reauthMu sync.Mutex
+
+	baseClient  *http.Client
+	middlewares []Middleware
+	// The client used for all requests, built from baseClient and middlewares
+	httpClient *http.Client
 }
 
 /*
 	NewOnlineYnoteClient creates a *YnoteClient for online service.
 */
-func NewOnlineYnoteClient(credentials Credentials) *YnoteClient {
-	return NewYnoteClient(credentials, OnlineUrlBase)
+func NewOnlineYnoteClient(credentials Credentials, opts ...Option) *YnoteClient {
+	return NewYnoteClient(credentials, OnlineUrlBase, opts...)
 }
 
 /*
 	NewOnlineYnoteClient creates a *YnoteClient for a service with speicified
 	URLBase.
 */
-func NewYnoteClient(credentials Credentials, urlBase string) *YnoteClient {
-	return &YnoteClient{
+func NewYnoteClient(credentials Credentials, urlBase string, opts ...Option) *YnoteClient {
+	yc := &YnoteClient{
 		URLBase: urlBase,
 		oauthClient: oauth.Client{
 			Credentials:                   oauth.Credentials(credentials),
@@ -89,25 +108,41 @@ func NewYnoteClient(credentials Credentials, urlBase string) *YnoteClient {
 			TokenRequestURI:               urlBase + "/oauth/access_token",
 		},
 	}
+	for _, opt := range opts {
+		opt(yc)
+	}
+	yc.httpClient = yc.buildHTTPClient()
+	return yc
 }
 
 /*
 	RequestTemporaryCredentials requests a temporary token
 */
 func (yc *YnoteClient) RequestTemporaryCredentials() (*Credentials, error) {
-	tmpCred, err := yc.oauthClient.RequestTemporaryCredentials(http.DefaultClient, "", nil)
-	if err != nil {
-		return nil, err
-	}
-	return (*Credentials)(tmpCred), nil
+	return yc.RequestTemporaryCredentialsContext(context.Background())
+}
 
+/*
+	RequestTemporaryCredentialsContext is like RequestTemporaryCredentials but
+	the request is bound to ctx.
+*/
+func (yc *YnoteClient) RequestTemporaryCredentialsContext(ctx context.Context) (*Credentials, error) {
+	return yc.RequestTemporaryCredentialsWithCallBackContext(ctx, "")
 }
 
 /*
 	RequestTemporaryCredentials requests a temporary token with a callback url
 */
 func (yc *YnoteClient) RequestTemporaryCredentialsWithCallBack(callback string) (*Credentials, error) {
-	tmpCred, err := yc.oauthClient.RequestTemporaryCredentials(http.DefaultClient, callback, nil)
+	return yc.RequestTemporaryCredentialsWithCallBackContext(context.Background(), callback)
+}
+
+/*
+	RequestTemporaryCredentialsWithCallBackContext is like
+	RequestTemporaryCredentialsWithCallBack but the request is bound to ctx.
+*/
+func (yc *YnoteClient) RequestTemporaryCredentialsWithCallBackContext(ctx context.Context, callback string) (*Credentials, error) {
+	tmpCred, err := yc.oauthClient.RequestTemporaryCredentials(contextClient(ctx, yc.client()), callback, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -123,15 +158,23 @@ func (yc *YnoteClient) AuthorizationURL(tmpCred *Credentials) string {
 }
 
 /*
-	RequestTemporaryCredentials returns the access token given the verifier
+	RequestTemporaryCredentials returns the access token given the verifier. The
+	token is saved to the token store, if any.
 */
 func (yc *YnoteClient) RequestToken(tmpCred *Credentials, verifier string) (accToken *Credentials, err error) {
-	token, _, err := yc.oauthClient.RequestToken(http.DefaultClient, (*oauth.Credentials)(tmpCred), verifier)
+	return yc.RequestTokenContext(context.Background(), tmpCred, verifier)
+}
+
+/*
+	RequestTokenContext is like RequestToken but the request is bound to ctx.
+*/
+func (yc *YnoteClient) RequestTokenContext(ctx context.Context, tmpCred *Credentials, verifier string) (accToken *Credentials, err error) {
+	token, _, err := yc.oauthClient.RequestToken(contextClient(ctx, yc.client()), (*oauth.Credentials)(tmpCred), verifier)
 	if err != nil {
 		return nil, err
 	}
-	yc.AccToken = (*Credentials)(token)
-	return yc.AccToken, err
+	yc.setAccToken((*Credentials)(token))
+	return (*Credentials)(token), yc.saveAccToken()
 }
 
 /* Information of the ynote user. */
@@ -158,12 +201,15 @@ type UserInfo struct {
 	UserInfo fetches the information of the ynote user
 */
 func (yc *YnoteClient) UserInfo() (ui *UserInfo, err error) {
+	return yc.UserInfoContext(context.Background())
+}
+
+/*
+	UserInfoContext is like UserInfo but the request is bound to ctx.
+*/
+func (yc *YnoteClient) UserInfoContext(ctx context.Context) (ui *UserInfo, err error) {
 	reqUrl := yc.URLBase + "/yws/open/user/get.json"
-	res, err := yc.oauthClient.Get(http.DefaultClient, (*oauth.Credentials)(yc.AccToken), reqUrl, nil)
-	if err != nil {
-		return nil, err
-	}
-	js, err := ioutil.ReadAll(res.Body)
+	js, err := yc.call(ctx, &apiRequest{method: "GET", url: reqUrl, idempotent: true})
 	if err != nil {
 		return nil, err
 	}
@@ -183,10 +229,6 @@ func (yc *YnoteClient) UserInfo() (ui *UserInfo, err error) {
 		return nil, errors.New("Response is not a JSON: " + string(js))
 	}
 
-	if res.StatusCode == 500 {
-		return nil, parseFailInfo(js)
-	}
-
 	return &UserInfo{
 		ID:              userInfo.ID,
 		User:            userInfo.User,
@@ -250,61 +292,28 @@ func parseNotebookInfo(js []byte) (*NotebookInfo, error) {
 	return nbInfo.asNotebookInfo(), nil
 }
 
-/* The information for a failure calling. It is returned as an error. */
-type FailInfo struct {
-	Message string
-	Err     string
-}
-
-/* Implementation of error.Error  */
-func (info *FailInfo) Error() string {
-	return fmt.Sprintf("%s: %s", info.Err, info.Message)
-}
-
-func parseFailInfo(js []byte) *FailInfo {
-	var failInfo struct {
-		Message string `json:"message"`
-		Error   string `json:"error"`
-	}
-
-	err := json.Unmarshal(js, &failInfo)
-	if err != nil {
-		return &FailInfo{
-			Message: "Parse FailInfo failed: " + string(js),
-			Err:     "Invalid JSON",
-		}
-	}
-
-	return &FailInfo{
-		Message: failInfo.Message,
-		Err:     failInfo.Error,
-	}
-}
-
 /*
 	CreateNotebook creates a new note book with specified name. A *NotebookInfo
 	is returned if succeeds, non-nil error returned otherwise
 */
 func (yc *YnoteClient) CreateNotebook(name, group string) (*NotebookInfo, error) {
+	return yc.CreateNotebookContext(context.Background(), name, group)
+}
+
+/*
+	CreateNotebookContext is like CreateNotebook but the request is bound to ctx.
+*/
+func (yc *YnoteClient) CreateNotebookContext(ctx context.Context, name, group string) (*NotebookInfo, error) {
 	reqUrl := yc.URLBase + "/yws/open/notebook/create.json"
 
 	params := make(url.Values)
 	params.Set("name", name)
 	params.Set("group", group)
 
-	res, err := yc.oauthClient.Post(http.DefaultClient, (*oauth.Credentials)(yc.AccToken), reqUrl, params)
-	if err != nil {
-		return nil, err
-	}
-	defer res.Body.Close()
-
-	js, err := ioutil.ReadAll(res.Body)
+	js, err := yc.call(ctx, &apiRequest{method: "POST", url: reqUrl, params: params})
 	if err != nil {
 		return nil, err
 	}
-	if res.StatusCode == 500 {
-		return nil, parseFailInfo(js)
-	}
 	return parseNotebookInfo(js)
 }
 
@@ -312,20 +321,18 @@ func (yc *YnoteClient) CreateNotebook(name, group string) (*NotebookInfo, error)
 	ListNotebooks returns all notebooks.
 */
 func (yc *YnoteClient) ListNotebooks() ([]*NotebookInfo, error) {
-	reqUrl := yc.URLBase + "/yws/open/notebook/all.json"
-	res, err := yc.oauthClient.Post(http.DefaultClient, (*oauth.Credentials)(yc.AccToken), reqUrl, nil)
-	if err != nil {
-		return nil, err
-	}
-	defer res.Body.Close()
+	return yc.ListNotebooksContext(context.Background())
+}
 
-	js, err := ioutil.ReadAll(res.Body)
+/*
+	ListNotebooksContext is like ListNotebooks but the request is bound to ctx.
+*/
+func (yc *YnoteClient) ListNotebooksContext(ctx context.Context) ([]*NotebookInfo, error) {
+	reqUrl := yc.URLBase + "/yws/open/notebook/all.json"
+	js, err := yc.call(ctx, &apiRequest{method: "POST", url: reqUrl, idempotent: true})
 	if err != nil {
 		return nil, err
 	}
-	if res.StatusCode == 500 {
-		return nil, parseFailInfo(js)
-	}
 
 	var nbInfos []notebookInfo
 	err = json.Unmarshal(js, &nbInfos)
@@ -345,7 +352,14 @@ func (yc *YnoteClient) ListNotebooks() ([]*NotebookInfo, error) {
 	found. Set group to "*" to match any group.
 */
 func (yc *YnoteClient) FindNotebook(group, name string) (*NotebookInfo, error) {
-	nbs, err := yc.ListNotebooks()
+	return yc.FindNotebookContext(context.Background(), group, name)
+}
+
+/*
+	FindNotebookContext is like FindNotebook but the request is bound to ctx.
+*/
+func (yc *YnoteClient) FindNotebookContext(ctx context.Context, group, name string) (*NotebookInfo, error) {
+	nbs, err := yc.ListNotebooksContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -363,64 +377,136 @@ func (yc *YnoteClient) FindNotebook(group, name string) (*NotebookInfo, error) {
 	otherwise.
 */
 func (yc *YnoteClient) DeleteNotebook(path string) error {
+	return yc.DeleteNotebookContext(context.Background(), path)
+}
+
+/*
+	DeleteNotebookContext is like DeleteNotebook but the request is bound to ctx.
+*/
+func (yc *YnoteClient) DeleteNotebookContext(ctx context.Context, path string) error {
 	reqUrl := yc.URLBase + "/yws/open/notebook/delete.json"
 
 	params := make(url.Values)
 	params.Set("notebook", path)
 
-	res, err := yc.oauthClient.Post(http.DefaultClient, (*oauth.Credentials)(yc.AccToken), reqUrl, params)
+	_, err := yc.call(ctx, &apiRequest{method: "POST", url: reqUrl, params: params})
 	if err != nil {
 		return err
 	}
-	defer res.Body.Close()
-
-	js, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return err
-	}
-
-	if res.StatusCode == 500 {
-		return parseFailInfo(js)
-	}
 
 	return nil
 }
 
-// Post issues a POST with the specified form.
-func multipartPost(c *oauth.Client, client *http.Client,
-	credentials *oauth.Credentials, urlStr string, form url.Values,
-	files map[string]struct {
-		filename string
-		r        io.Reader
-	}) (*http.Response, error) {
-	var bf = &bytes.Buffer{}
-	mw := multipart.NewWriter(bf)
-	contentType := mw.FormDataContentType()
-	for k := range form {
-		mw.WriteField(k, form.Get(k))
-	}
+/*
+	apiRequest describes a call to the open API. The request body is rebuilt
+	and re-signed from it for every attempt.
+*/
+type apiRequest struct {
+	method string
+	url    string
+	params url.Values
+	// Whether to post params (and files) as multipart/form-data
+	multipart bool
+	files     map[string]fileSource
+	// Whether the call can be safely retried
+	idempotent bool
+}
 
-	for field, entry := range files {
-		w, err := mw.CreateFormFile(field, filepath.Base(entry.filename))
+/*
+	call issues the request described by r, retrying according to the retry
+	policy of yc, and returns the body of a successful response. A response
+	with a non-2xx status is returned as a *FailInfo. If the access token
+	expired, the call is replayed after reauthorizing, if configured.
+*/
+func (yc *YnoteClient) call(ctx context.Context, r *apiRequest) (js []byte, err error) {
+	err = yc.withReauthorize(ctx, func() error {
+		js, err = yc.callWithRetry(ctx, r)
+		return err
+	})
+	return js, err
+}
+
+func (yc *YnoteClient) callWithRetry(ctx context.Context, r *apiRequest) ([]byte, error) {
+	result := func(res *http.Response, js []byte, err error) ([]byte, error) {
 		if err != nil {
 			return nil, err
 		}
-
-		_, err = io.Copy(w, entry.r)
-		if err != nil {
+		return checkResponse(res, js)
+	}
+
+	var prevRes *http.Response
+	var prevJs []byte
+	var prevErr error
+	for attempt := 1; ; attempt++ {
+		res, js, err := yc.attempt(ctx, r)
+		if err == errNotReplayable && attempt > 1 {
+			// The content was consumed by the previous attempt, whose failure
+			// is more useful.
+			return result(prevRes, prevJs, prevErr)
+		}
+		if !yc.shouldRetry(ctx, r, attempt, res, js, err) {
+			return result(res, js, err)
+		}
+		if err := yc.retryPolicy.sleep(ctx, attempt, retryAfter(res)); err != nil {
 			return nil, err
 		}
+		prevRes, prevJs, prevErr = res, js, err
+	}
+}
+
+/* attempt issues r once and reads the whole response body. */
+func (yc *YnoteClient) attempt(ctx context.Context, r *apiRequest) (*http.Response, []byte, error) {
+	if err := yc.waitRateLimit(ctx, familyOf(r.url)); err != nil {
+		return nil, nil, err
 	}
-	mw.Close()
 
-	req, err := http.NewRequest("POST", urlStr, bf)
+	// Signing adds oauth_* parameters, so work on a copy.
+	form := make(url.Values)
+	for k, vs := range r.params {
+		form[k] = append([]string(nil), vs...)
+	}
+
+	var res *http.Response
+	var err error
+	if r.multipart {
+		res, err = multipartPost(ctx, &yc.oauthClient, yc.client(),
+			(*oauth.Credentials)(yc.accToken()), r.url, form, r.files)
+	} else {
+		res, err = yc.oauthRequest(ctx, r.method, r.url, form)
+	}
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	js, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, err
 	}
-	req.Header.Set("Content-Type", contentType)
+	return res, js, nil
+}
+
+/*
+	oauthRequest signs form with the access token and issues a request bound to
+	ctx. For GET the form is sent as the query, otherwise as an urlencoded body.
+*/
+func (yc *YnoteClient) oauthRequest(ctx context.Context, method, urlStr string, form url.Values) (*http.Response, error) {
+	yc.oauthClient.SignForm((*oauth.Credentials)(yc.accToken()), method, urlStr, form)
 
-	req.Header.Set("Authorization", c.AuthorizationHeader(credentials, "POST", req.URL, nil))
-	return client.Do(req)
+	var req *http.Request
+	var err error
+	if method == "GET" {
+		req, err = http.NewRequestWithContext(ctx, method, urlStr+"?"+form.Encode(), nil)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, method, urlStr, strings.NewReader(form.Encode()))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if method != "GET" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	return yc.client().Do(req)
 }
 
 /*
@@ -428,6 +514,13 @@ func multipartPost(c *oauth.Client, client *http.Client,
 	new note is returned if succeed.
 */
 func (yc *YnoteClient) CreateNote(notebookPath, title, author, source, content string) (string, error) {
+	return yc.CreateNoteContext(context.Background(), notebookPath, title, author, source, content)
+}
+
+/*
+	CreateNoteContext is like CreateNote but the request is bound to ctx.
+*/
+func (yc *YnoteClient) CreateNoteContext(ctx context.Context, notebookPath, title, author, source, content string) (string, error) {
 	reqUrl := yc.URLBase + "/yws/open/note/create.json"
 
 	params := make(url.Values)
@@ -437,20 +530,10 @@ func (yc *YnoteClient) CreateNote(notebookPath, title, author, source, content s
 	params.Set("source", source)
 	params.Set("content", content)
 
-	res, err := multipartPost(&yc.oauthClient, http.DefaultClient, (*oauth.Credentials)(yc.AccToken), reqUrl, params, nil)
+	js, err := yc.call(ctx, &apiRequest{method: "POST", url: reqUrl, params: params, multipart: true})
 	if err != nil {
 		return "", err
 	}
-	defer res.Body.Close()
-
-	js, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return "", err
-	}
-
-	if res.StatusCode == 500 {
-		return "", parseFailInfo(js)
-	}
 
 	var path struct {
 		Path string `json:"path"`
@@ -467,24 +550,22 @@ func (yc *YnoteClient) CreateNote(notebookPath, title, author, source, content s
 	ListNotes returns a list of path to all the notes in a notebook.
 */
 func (yc *YnoteClient) ListNotes(notebookPath string) ([]string, error) {
+	return yc.ListNotesContext(context.Background(), notebookPath)
+}
+
+/*
+	ListNotesContext is like ListNotes but the request is bound to ctx.
+*/
+func (yc *YnoteClient) ListNotesContext(ctx context.Context, notebookPath string) ([]string, error) {
 	reqUrl := yc.URLBase + "/yws/open/notebook/list.json"
 
 	params := make(url.Values)
 	params.Set("notebook", notebookPath)
 
-	res, err := yc.oauthClient.Post(http.DefaultClient, (*oauth.Credentials)(yc.AccToken), reqUrl, params)
+	js, err := yc.call(ctx, &apiRequest{method: "POST", url: reqUrl, params: params, idempotent: true})
 	if err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
-
-	js, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, err
-	}
-	if res.StatusCode == 500 {
-		return nil, parseFailInfo(js)
-	}
 
 	var notes []string
 	err = json.Unmarshal(js, &notes)
@@ -519,24 +600,22 @@ type NoteInfo struct {
 	NoteInfo returns the information and content of a note
 */
 func (yc *YnoteClient) NoteInfo(path string) (*NoteInfo, error) {
+	return yc.NoteInfoContext(context.Background(), path)
+}
+
+/*
+	NoteInfoContext is like NoteInfo but the request is bound to ctx.
+*/
+func (yc *YnoteClient) NoteInfoContext(ctx context.Context, path string) (*NoteInfo, error) {
 	reqUrl := yc.URLBase + "/yws/open/note/get.json"
 
 	params := make(url.Values)
 	params.Set("path", path)
 
-	res, err := yc.oauthClient.Post(http.DefaultClient, (*oauth.Credentials)(yc.AccToken), reqUrl, params)
+	js, err := yc.call(ctx, &apiRequest{method: "POST", url: reqUrl, params: params, idempotent: true})
 	if err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
-
-	js, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, err
-	}
-	if res.StatusCode == 500 {
-		return nil, parseFailInfo(js)
-	}
 
 	var noteInfo struct {
 		Title      string `json:"title"`
@@ -568,6 +647,13 @@ func (yc *YnoteClient) NoteInfo(path string) (*NoteInfo, error) {
 	UpdateNote modifies the title/author/source/content of a note
 */
 func (yc *YnoteClient) UpdateNote(path, title, author, source, content string) error {
+	return yc.UpdateNoteContext(context.Background(), path, title, author, source, content)
+}
+
+/*
+	UpdateNoteContext is like UpdateNote but the request is bound to ctx.
+*/
+func (yc *YnoteClient) UpdateNoteContext(ctx context.Context, path, title, author, source, content string) error {
 	reqUrl := yc.URLBase + "/yws/open/note/update.json"
 
 	params := make(url.Values)
@@ -577,22 +663,11 @@ func (yc *YnoteClient) UpdateNote(path, title, author, source, content string) e
 	params.Set("source", source)
 	params.Set("content", content)
 
-	res, err := multipartPost(&yc.oauthClient, http.DefaultClient,
-		(*oauth.Credentials)(yc.AccToken), reqUrl, params, nil)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
-
-	js, err := ioutil.ReadAll(res.Body)
+	_, err := yc.call(ctx, &apiRequest{method: "POST", url: reqUrl, params: params, multipart: true})
 	if err != nil {
 		return err
 	}
 
-	if res.StatusCode == 500 {
-		return parseFailInfo(js)
-	}
-
 	return nil
 }
 
@@ -600,26 +675,23 @@ func (yc *YnoteClient) UpdateNote(path, title, author, source, content string) e
 	DeleteNote deletes a note
 */
 func (yc *YnoteClient) DeleteNote(path string) error {
+	return yc.DeleteNoteContext(context.Background(), path)
+}
+
+/*
+	DeleteNoteContext is like DeleteNote but the request is bound to ctx.
+*/
+func (yc *YnoteClient) DeleteNoteContext(ctx context.Context, path string) error {
 	reqUrl := yc.URLBase + "/yws/open/note/delete.json"
 
 	params := make(url.Values)
 	params.Set("path", path)
 
-	res, err := yc.oauthClient.Post(http.DefaultClient, (*oauth.Credentials)(yc.AccToken), reqUrl, params)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
-
-	js, err := ioutil.ReadAll(res.Body)
+	_, err := yc.call(ctx, &apiRequest{method: "POST", url: reqUrl, params: params})
 	if err != nil {
 		return err
 	}
 
-	if res.StatusCode == 500 {
-		return parseFailInfo(js)
-	}
-
 	return nil
 }
 
@@ -627,26 +699,23 @@ func (yc *YnoteClient) DeleteNote(path string) error {
 	MoveNote moves a note into another notebook
 */
 func (yc *YnoteClient) MoveNote(notePath, notebookPath string) error {
+	return yc.MoveNoteContext(context.Background(), notePath, notebookPath)
+}
+
+/*
+	MoveNoteContext is like MoveNote but the request is bound to ctx.
+*/
+func (yc *YnoteClient) MoveNoteContext(ctx context.Context, notePath, notebookPath string) error {
 	reqUrl := yc.URLBase + "/yws/open/note/move.json"
 
 	params := make(url.Values)
 	params.Set("path", notePath)
 	params.Set("notebook", notebookPath)
 
-	res, err := yc.oauthClient.Post(http.DefaultClient, (*oauth.Credentials)(yc.AccToken), reqUrl, params)
+	_, err := yc.call(ctx, &apiRequest{method: "POST", url: reqUrl, params: params})
 	if err != nil {
 		return err
 	}
-	defer res.Body.Close()
-
-	js, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return err
-	}
-
-	if res.StatusCode == 500 {
-		return parseFailInfo(js)
-	}
 
 	return nil
 }
@@ -663,39 +732,56 @@ type AttachInfo struct {
 	UploadAttachment uploads an attachment
 */
 func (yc *YnoteClient) UploadAttachment(filename string) (*AttachInfo, error) {
-	reqUrl := yc.URLBase + "/yws/open/resource/upload.json"
+	return yc.UploadAttachmentContext(context.Background(), filename)
+}
 
-	f, err := os.Open(filename)
+/*
+	UploadAttachmentContext is like UploadAttachment but the request is bound to ctx.
+*/
+func (yc *YnoteClient) UploadAttachmentContext(ctx context.Context, filename string) (*AttachInfo, error) {
+	fi, err := os.Stat(filename)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-	files := map[string]struct {
-		filename string
-		r        io.Reader
-	}{
-		"file": {
-			filename: filename,
-			r:        f,
+
+	return yc.uploadAttachment(ctx, fileSource{
+		filename: filename,
+		size:     fi.Size(),
+		open: func() (io.ReadCloser, error) {
+			return os.Open(filename)
 		},
-	}
+	})
+}
 
-	res, err := multipartPost(&yc.oauthClient, http.DefaultClient,
-		(*oauth.Credentials)(yc.AccToken), reqUrl, nil, files)
-	if err != nil {
-		return nil, err
+/*
+	UploadAttachmentReader uploads an attachment named name with the content
+	read from r. size is the number of bytes to read from r, or -1 if unknown.
+	The content is streamed rather than buffered in memory.
+
+	If r is an io.Seeker, it is rewound when the upload is retried or replayed,
+	otherwise the upload is attempted only once.
+*/
+func (yc *YnoteClient) UploadAttachmentReader(ctx context.Context, name string, r io.Reader, size int64) (*AttachInfo, error) {
+	return yc.uploadAttachment(ctx, fileSource{
+		filename: name,
+		size:     size,
+		open:     readerOpener(r),
+	})
+}
+
+func (yc *YnoteClient) uploadAttachment(ctx context.Context, file fileSource) (*AttachInfo, error) {
+	reqUrl := yc.URLBase + "/yws/open/resource/upload.json"
+
+	file.progress = yc.progress
+	files := map[string]fileSource{
+		"file": file,
 	}
-	defer res.Body.Close()
 
-	js, err := ioutil.ReadAll(res.Body)
+	js, err := yc.call(ctx, &apiRequest{method: "POST", url: reqUrl, multipart: true, files: files})
 	if err != nil {
 		return nil, err
 	}
 
-	if res.StatusCode == 500 {
-		return nil, parseFailInfo(js)
-	}
-
 	var attachInfo struct {
 		URL string `json:"url"`
 		Src string `json:"src"`
@@ -718,6 +804,6 @@ func (yc *YnoteClient) UploadAttachment(filename string) (*AttachInfo, error) {
 */
 func (yc *YnoteClient) AuthorizeDownloadLink(link string) string {
 	params := make(url.Values)
-	yc.oauthClient.SignForm((*oauth.Credentials)(yc.AccToken), "GET", link, params)
+	yc.oauthClient.SignForm((*oauth.Credentials)(yc.accToken()), "GET", link, params)
 	return link + "?" + params.Encode()
 }
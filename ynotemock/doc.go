@@ -0,0 +1,65 @@
+/*
+	Package ynotemock provides Mock, an in-memory implementation of
+	ynote.NoteService for unit tests, generated from the interface.
+
+	Set the function field of a method to define its behavior, e.g.
+
+		m := &ynotemock.Mock{
+			NoteInfoContextFunc: func(ctx context.Context, path string) (*ynote.NoteInfo, error) {
+				return &ynote.NoteInfo{Title: "title"}, nil
+			},
+		}
+
+	A method whose function field is nil returns zero values and
+	ErrNotImplemented. All calls are recorded and returned by Calls.
+*/
+package ynotemock
+
+//go:generate go run gen.go
+
+import (
+	"errors"
+	"sync"
+)
+
+/* ErrNotImplemented is returned by a method of Mock without a function. */
+var ErrNotImplemented = errors.New("ynotemock: method not implemented")
+
+/* Call is a recorded call of a method of Mock. */
+type Call struct {
+	// Name of the method, e.g. "NoteInfoContext"
+	Method string
+	// Arguments of the call
+	Args []interface{}
+}
+
+type recorder struct {
+	mu    sync.Mutex
+	calls []Call
+}
+
+func (r *recorder) record(method string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = append(r.calls, Call{Method: method, Args: args})
+}
+
+/* Calls returns the calls recorded so far, in order. */
+func (r *recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Call(nil), r.calls...)
+}
+
+/* CallsOf returns the recorded calls of a method, in order. */
+func (r *recorder) CallsOf(method string) []Call {
+	var calls []Call
+	for _, c := range r.Calls() {
+		if c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
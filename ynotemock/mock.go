@@ -0,0 +1,169 @@
+// Code generated by gen.go from ../service.go; DO NOT EDIT.
+
+package ynotemock
+
+import (
+	"context"
+	"io"
+
+	ynote "github.com/youdao-api/go-ynote"
+)
+
+// Mock implements ynote.NoteService by calling the function fields, and
+// records the calls.
+type Mock struct {
+	recorder
+
+	UserInfoContextFunc         func(ctx context.Context) (*ynote.UserInfo, error)
+	CreateNotebookContextFunc   func(ctx context.Context, name string, group string) (*ynote.NotebookInfo, error)
+	ListNotebooksContextFunc    func(ctx context.Context) ([]*ynote.NotebookInfo, error)
+	DeleteNotebookContextFunc   func(ctx context.Context, path string) error
+	CreateNoteContextFunc       func(ctx context.Context, notebookPath string, title string, author string, source string, content string) (string, error)
+	ListNotesContextFunc        func(ctx context.Context, notebookPath string) ([]string, error)
+	NoteInfoContextFunc         func(ctx context.Context, path string) (*ynote.NoteInfo, error)
+	UpdateNoteContextFunc       func(ctx context.Context, path string, title string, author string, source string, content string) error
+	DeleteNoteContextFunc       func(ctx context.Context, path string) error
+	MoveNoteContextFunc         func(ctx context.Context, notePath string, notebookPath string) error
+	UploadAttachmentContextFunc func(ctx context.Context, filename string) (*ynote.AttachInfo, error)
+	UploadAttachmentReaderFunc  func(ctx context.Context, name string, r io.Reader, size int64) (*ynote.AttachInfo, error)
+	AuthorizeDownloadLinkFunc   func(link string) string
+	DownloadAttachmentFunc      func(ctx context.Context, link string, w io.Writer) (int64, error)
+}
+
+var _ ynote.NoteService = (*Mock)(nil)
+
+// UserInfoContext implements ynote.NoteService.
+func (m *Mock) UserInfoContext(ctx context.Context) (*ynote.UserInfo, error) {
+	m.record("UserInfoContext", ctx)
+	if m.UserInfoContextFunc != nil {
+		return m.UserInfoContextFunc(ctx)
+	}
+	var r0 *ynote.UserInfo
+	return r0, ErrNotImplemented
+}
+
+// CreateNotebookContext implements ynote.NoteService.
+func (m *Mock) CreateNotebookContext(ctx context.Context, name string, group string) (*ynote.NotebookInfo, error) {
+	m.record("CreateNotebookContext", ctx, name, group)
+	if m.CreateNotebookContextFunc != nil {
+		return m.CreateNotebookContextFunc(ctx, name, group)
+	}
+	var r0 *ynote.NotebookInfo
+	return r0, ErrNotImplemented
+}
+
+// ListNotebooksContext implements ynote.NoteService.
+func (m *Mock) ListNotebooksContext(ctx context.Context) ([]*ynote.NotebookInfo, error) {
+	m.record("ListNotebooksContext", ctx)
+	if m.ListNotebooksContextFunc != nil {
+		return m.ListNotebooksContextFunc(ctx)
+	}
+	var r0 []*ynote.NotebookInfo
+	return r0, ErrNotImplemented
+}
+
+// DeleteNotebookContext implements ynote.NoteService.
+func (m *Mock) DeleteNotebookContext(ctx context.Context, path string) error {
+	m.record("DeleteNotebookContext", ctx, path)
+	if m.DeleteNotebookContextFunc != nil {
+		return m.DeleteNotebookContextFunc(ctx, path)
+	}
+	return ErrNotImplemented
+}
+
+// CreateNoteContext implements ynote.NoteService.
+func (m *Mock) CreateNoteContext(ctx context.Context, notebookPath string, title string, author string, source string, content string) (string, error) {
+	m.record("CreateNoteContext", ctx, notebookPath, title, author, source, content)
+	if m.CreateNoteContextFunc != nil {
+		return m.CreateNoteContextFunc(ctx, notebookPath, title, author, source, content)
+	}
+	var r0 string
+	return r0, ErrNotImplemented
+}
+
+// ListNotesContext implements ynote.NoteService.
+func (m *Mock) ListNotesContext(ctx context.Context, notebookPath string) ([]string, error) {
+	m.record("ListNotesContext", ctx, notebookPath)
+	if m.ListNotesContextFunc != nil {
+		return m.ListNotesContextFunc(ctx, notebookPath)
+	}
+	var r0 []string
+	return r0, ErrNotImplemented
+}
+
+// NoteInfoContext implements ynote.NoteService.
+func (m *Mock) NoteInfoContext(ctx context.Context, path string) (*ynote.NoteInfo, error) {
+	m.record("NoteInfoContext", ctx, path)
+	if m.NoteInfoContextFunc != nil {
+		return m.NoteInfoContextFunc(ctx, path)
+	}
+	var r0 *ynote.NoteInfo
+	return r0, ErrNotImplemented
+}
+
+// UpdateNoteContext implements ynote.NoteService.
+func (m *Mock) UpdateNoteContext(ctx context.Context, path string, title string, author string, source string, content string) error {
+	m.record("UpdateNoteContext", ctx, path, title, author, source, content)
+	if m.UpdateNoteContextFunc != nil {
+		return m.UpdateNoteContextFunc(ctx, path, title, author, source, content)
+	}
+	return ErrNotImplemented
+}
+
+// DeleteNoteContext implements ynote.NoteService.
+func (m *Mock) DeleteNoteContext(ctx context.Context, path string) error {
+	m.record("DeleteNoteContext", ctx, path)
+	if m.DeleteNoteContextFunc != nil {
+		return m.DeleteNoteContextFunc(ctx, path)
+	}
+	return ErrNotImplemented
+}
+
+// MoveNoteContext implements ynote.NoteService.
+func (m *Mock) MoveNoteContext(ctx context.Context, notePath string, notebookPath string) error {
+	m.record("MoveNoteContext", ctx, notePath, notebookPath)
+	if m.MoveNoteContextFunc != nil {
+		return m.MoveNoteContextFunc(ctx, notePath, notebookPath)
+	}
+	return ErrNotImplemented
+}
+
+// UploadAttachmentContext implements ynote.NoteService.
+func (m *Mock) UploadAttachmentContext(ctx context.Context, filename string) (*ynote.AttachInfo, error) {
+	m.record("UploadAttachmentContext", ctx, filename)
+	if m.UploadAttachmentContextFunc != nil {
+		return m.UploadAttachmentContextFunc(ctx, filename)
+	}
+	var r0 *ynote.AttachInfo
+	return r0, ErrNotImplemented
+}
+
+// UploadAttachmentReader implements ynote.NoteService.
+func (m *Mock) UploadAttachmentReader(ctx context.Context, name string, r io.Reader, size int64) (*ynote.AttachInfo, error) {
+	m.record("UploadAttachmentReader", ctx, name, r, size)
+	if m.UploadAttachmentReaderFunc != nil {
+		return m.UploadAttachmentReaderFunc(ctx, name, r, size)
+	}
+	var r0 *ynote.AttachInfo
+	return r0, ErrNotImplemented
+}
+
+// AuthorizeDownloadLink implements ynote.NoteService.
+func (m *Mock) AuthorizeDownloadLink(link string) string {
+	m.record("AuthorizeDownloadLink", link)
+	if m.AuthorizeDownloadLinkFunc != nil {
+		return m.AuthorizeDownloadLinkFunc(link)
+	}
+	var r0 string
+	return r0
+}
+
+// DownloadAttachment implements ynote.NoteService.
+func (m *Mock) DownloadAttachment(ctx context.Context, link string, w io.Writer) (int64, error) {
+	m.record("DownloadAttachment", ctx, link, w)
+	if m.DownloadAttachmentFunc != nil {
+		return m.DownloadAttachmentFunc(ctx, link, w)
+	}
+	var r0 int64
+	return r0, ErrNotImplemented
+}
@@ -0,0 +1,117 @@
+package ynotetest
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+/*
+	oauthParams returns all the parameters of r taking part in the signature:
+	the query, an urlencoded body and the oauth_* parameters of the
+	Authorization header.
+*/
+func oauthParams(r *http.Request) (url.Values, error) {
+	params := make(url.Values)
+	for k, vs := range r.URL.Query() {
+		params[k] = append(params[k], vs...)
+	}
+	if r.Method == "POST" && strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+		for k, vs := range r.PostForm {
+			params[k] = append(params[k], vs...)
+		}
+	}
+
+	auth := r.Header.Get("Authorization")
+	if strings.HasPrefix(auth, "OAuth ") {
+		for _, kv := range strings.Split(auth[len("OAuth "):], ",") {
+			kv = strings.TrimSpace(kv)
+			idx := strings.Index(kv, "=")
+			if idx < 0 {
+				return nil, errors.New("invalid Authorization header")
+			}
+			k, v := kv[:idx], strings.Trim(kv[idx+1:], `"`)
+			if k == "realm" {
+				continue
+			}
+			v, err := url.PathUnescape(v)
+			if err != nil {
+				return nil, err
+			}
+			params.Set(k, v)
+		}
+	}
+	return params, nil
+}
+
+/* percentEncode encodes s as RFC 5849, section 3.6. */
+func percentEncode(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~':
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		}
+	}
+	return b.String()
+}
+
+/* signatureBase returns the signature base string of r, RFC 5849 3.4.1. */
+func signatureBase(r *http.Request, params url.Values) string {
+	var pairs [][2]string
+	for k, vs := range params {
+		if k == "oauth_signature" {
+			continue
+		}
+		for _, v := range vs {
+			pairs = append(pairs, [2]string{percentEncode(k), percentEncode(v)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+	joined := make([]string, len(pairs))
+	for i, p := range pairs {
+		joined[i] = p[0] + "=" + p[1]
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	baseURL := scheme + "://" + strings.ToLower(r.Host) + r.URL.EscapedPath()
+	return r.Method + "&" + percentEncode(baseURL) + "&" +
+		percentEncode(strings.Join(joined, "&"))
+}
+
+/*
+	checkSignature reports whether the HMAC-SHA1 signature in params is valid
+	for the consumer and token secrets.
+*/
+func checkSignature(r *http.Request, params url.Values, consumerSecret, tokenSecret string) bool {
+	if params.Get("oauth_signature_method") != "HMAC-SHA1" {
+		return false
+	}
+	mac := hmac.New(sha1.New, []byte(percentEncode(consumerSecret)+"&"+percentEncode(tokenSecret)))
+	mac.Write([]byte(signatureBase(r, params)))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(params.Get("oauth_signature")))
+}
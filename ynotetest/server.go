@@ -0,0 +1,766 @@
+/*
+	Package ynotetest provides an in-process fake of the Youdao Note open API
+	for testing code using the ynote package without network access.
+
+	Usage:
+
+		srv := ynotetest.NewServer(ynotetest.Consumer)
+		defer srv.Close()
+
+		// A client authorized for the fake user
+		yc := srv.Client()
+
+		nb, err := yc.CreateNotebook("notebook", "")
+		...
+
+	The server keeps notebooks, notes and resources in memory, verifies the
+	OAuth (HMAC-SHA1) signature of every request, and can be told to fail
+	requests by InjectFailure. The authorization page approves every request
+	immediately, redirecting to the callback if there is one.
+
+	Failures are reported as the service does: status 500 and a JSON body
+	with the error code and a message, e.g. code 1013 (ynote.CodeNotFound)
+	for a note which does not exist, and 1007 (ynote.CodeTokenExpired) for
+	an invalid access token. Only failures of the OAuth signature itself are
+	reported with status 401.
+*/
+package ynotetest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ynote "github.com/youdao-api/go-ynote"
+)
+
+/* Consumer is a developer token/secret which can be used for tests. */
+var Consumer = ynote.Credentials{
+	Token:  "ynotetest-consumer",
+	Secret: "ynotetest-secret",
+}
+
+/* User is the name of the fake user. */
+const User = "ynotetest"
+
+/*
+	Failure describes requests to fail, injected by Server.InjectFailure.
+*/
+type Failure struct {
+	// Path of the endpoint, e.g. "/yws/open/note/get.json". Empty matches
+	// every request.
+	Path string
+	// Number of matching requests to fail. Zero fails all of them.
+	Times int
+
+	// The HTTP status of the response. Defaults to 500.
+	Status int
+	// If Err is not empty, the body is a FailInfo JSON with Err and Message,
+	// otherwise Body is sent as is.
+	Err     string
+	Message string
+	Body    string
+	// Extra headers of the response, e.g. Retry-After
+	Header http.Header
+}
+
+type notebook struct {
+	name       string
+	group      string
+	createTime time.Time
+	modifyTime time.Time
+	notes      []string
+}
+
+type note struct {
+	notebook   string
+	title      string
+	author     string
+	source     string
+	content    string
+	createTime time.Time
+	modifyTime time.Time
+}
+
+/*
+	Server is a fake Youdao Note service. It is safe for concurrent use.
+*/
+type Server struct {
+	*httptest.Server
+	consumer ynote.Credentials
+
+	// Now returns the current time used for creation/modification times. It
+	// can be replaced before the server is used, e.g. with a fake clock.
+	Now func() time.Time
+
+	mu         sync.Mutex
+	tmpTokens  map[string]*tmpToken
+	accTokens  map[string]string // token -> secret
+	notebooks  map[string]*notebook
+	notes      map[string]*note
+	resources  map[string][]byte
+	failures   []*Failure
+	registered time.Time
+	requests   int
+}
+
+type tmpToken struct {
+	secret   string
+	callback string
+	verifier string
+}
+
+/*
+	NewServer starts a Server accepting requests signed with the consumer
+	credentials. The caller should call Close when finished.
+*/
+func NewServer(consumer ynote.Credentials) *Server {
+	s := &Server{
+		consumer:   consumer,
+		Now:        time.Now,
+		tmpTokens:  make(map[string]*tmpToken),
+		accTokens:  make(map[string]string),
+		notebooks:  make(map[string]*notebook),
+		notes:      make(map[string]*note),
+		resources:  make(map[string][]byte),
+		registered: time.Now(),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/request_token", s.handleRequestToken)
+	mux.HandleFunc("/oauth/authorize", s.handleAuthorize)
+	mux.HandleFunc("/oauth/access_token", s.handleAccessToken)
+
+	api := map[string]func(w http.ResponseWriter, r *http.Request){
+		"user/get.json":        s.handleUser,
+		"notebook/create.json": s.handleCreateNotebook,
+		"notebook/all.json":    s.handleAllNotebooks,
+		"notebook/list.json":   s.handleListNotes,
+		"notebook/delete.json": s.handleDeleteNotebook,
+		"note/create.json":     s.handleCreateNote,
+		"note/get.json":        s.handleGetNote,
+		"note/update.json":     s.handleUpdateNote,
+		"note/delete.json":     s.handleDeleteNote,
+		"note/move.json":       s.handleMoveNote,
+		"resource/upload.json": s.handleUpload,
+		"resource/download/":   s.handleDownload,
+	}
+	for p, h := range api {
+		mux.Handle("/yws/open/"+p, s.authorized(h))
+	}
+
+	s.Server = httptest.NewServer(s.injectFailures(mux))
+	return s
+}
+
+/*
+	Client returns a *ynote.YnoteClient for the server, with the consumer
+	credentials and an access token issued by IssueToken.
+*/
+func (s *Server) Client(opts ...ynote.Option) *ynote.YnoteClient {
+	yc := ynote.NewYnoteClient(s.consumer, s.URL, opts...)
+	yc.AccToken = s.IssueToken()
+	return yc
+}
+
+/* IssueToken issues a new access token without the OAuth flow. */
+func (s *Server) IssueToken() *ynote.Credentials {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token := &ynote.Credentials{Token: newID(), Secret: newID()}
+	s.accTokens[token.Token] = token.Secret
+	return token
+}
+
+/*
+	ExpireTokens invalidates all issued access tokens. Following requests with
+	them fail with code 1007, i.e. ynote.ErrTokenExpired.
+*/
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.accTokens = make(map[string]string)
+}
+
+/* InjectFailure makes the server fail requests as described by f. */
+func (s *Server) InjectFailure(f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = append(s.failures, &f)
+}
+
+/* ClearFailures removes all injected failures. */
+func (s *Server) ClearFailures() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = nil
+}
+
+/* Requests returns the number of requests the server has received. */
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+/*
+	Note returns the information of the note at path, or nil if it does not
+	exist.
+*/
+func (s *Server) Note(path string) *ynote.NoteInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := s.notes[path]
+	if n == nil {
+		return nil
+	}
+	return n.info()
+}
+
+/*
+	Resource returns the content of the uploaded resource with the download
+	URL, or nil if it does not exist.
+*/
+func (s *Server) Resource(url string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.resources[path.Base(url)]
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return strings.ToUpper(hex.EncodeToString(b))
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeFail(w http.ResponseWriter, status int, err, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":   err,
+		"message": message,
+	})
+}
+
+func notFound(w http.ResponseWriter, what, path string) {
+	writeFail(w, http.StatusInternalServerError, string(ynote.CodeNotFound),
+		fmt.Sprintf("%s %s not found", what, path))
+}
+
+func badParameter(w http.ResponseWriter, message string) {
+	writeFail(w, http.StatusInternalServerError, string(ynote.CodeBadParameter), message)
+}
+
+func (s *Server) injectFailures(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests++
+		var failure *Failure
+		for i, f := range s.failures {
+			if f.Path != "" && f.Path != r.URL.Path {
+				continue
+			}
+			failure = f
+			if f.Times > 0 {
+				if f.Times--; f.Times == 0 {
+					s.failures = append(s.failures[:i:i], s.failures[i+1:]...)
+				}
+			}
+			break
+		}
+		if failure != nil {
+			// Copied, the failure may be changed by later requests.
+			f := *failure
+			failure = &f
+		}
+		s.mu.Unlock()
+
+		if failure == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		for k, vs := range failure.Header {
+			w.Header()[k] = vs
+		}
+		status := failure.Status
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		if failure.Err != "" {
+			writeFail(w, status, failure.Err, failure.Message)
+			return
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(failure.Body))
+	})
+}
+
+func (s *Server) handleRequestToken(w http.ResponseWriter, r *http.Request) {
+	params, err := oauthParams(r)
+	if err != nil {
+		badParameter(w, err.Error())
+		return
+	}
+	if params.Get("oauth_consumer_key") != s.consumer.Token ||
+		!checkSignature(r, params, s.consumer.Secret, "") {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	token, tmp := newID(), &tmpToken{
+		secret:   newID(),
+		callback: params.Get("oauth_callback"),
+	}
+	s.mu.Lock()
+	s.tmpTokens[token] = tmp
+	s.mu.Unlock()
+
+	fmt.Fprint(w, url.Values{
+		"oauth_token":              {token},
+		"oauth_token_secret":       {tmp.secret},
+		"oauth_callback_confirmed": {"true"},
+	}.Encode())
+}
+
+/*
+	handleAuthorize approves the request immediately. The verifier is sent to
+	the callback, or shown in the page if there is none.
+*/
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("oauth_token")
+
+	s.mu.Lock()
+	tmp := s.tmpTokens[token]
+	var verifier, callbackURL string
+	if tmp != nil {
+		tmp.verifier = newID()
+		verifier, callbackURL = tmp.verifier, tmp.callback
+	}
+	s.mu.Unlock()
+
+	if tmp == nil {
+		http.Error(w, "invalid oauth_token", http.StatusBadRequest)
+		return
+	}
+
+	if callbackURL == "" || callbackURL == "oob" {
+		fmt.Fprintf(w, "<html><body>verifier: <span id=\"verifier\">%s</span></body></html>", verifier)
+		return
+	}
+	callback, err := url.Parse(callbackURL)
+	if err != nil {
+		http.Error(w, "invalid oauth_callback", http.StatusBadRequest)
+		return
+	}
+	q := callback.Query()
+	q.Set("oauth_token", token)
+	q.Set("oauth_verifier", verifier)
+	callback.RawQuery = q.Encode()
+	http.Redirect(w, r, callback.String(), http.StatusFound)
+}
+
+func (s *Server) handleAccessToken(w http.ResponseWriter, r *http.Request) {
+	params, err := oauthParams(r)
+	if err != nil {
+		badParameter(w, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token := params.Get("oauth_token")
+	tmp := s.tmpTokens[token]
+	if tmp == nil || params.Get("oauth_consumer_key") != s.consumer.Token ||
+		!checkSignature(r, params, s.consumer.Secret, tmp.secret) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	if tmp.verifier == "" || params.Get("oauth_verifier") != tmp.verifier {
+		http.Error(w, "invalid oauth_verifier", http.StatusUnauthorized)
+		return
+	}
+	delete(s.tmpTokens, token)
+
+	acc := ynote.Credentials{Token: newID(), Secret: newID()}
+	s.accTokens[acc.Token] = acc.Secret
+	fmt.Fprint(w, url.Values{
+		"oauth_token":        {acc.Token},
+		"oauth_token_secret": {acc.Secret},
+	}.Encode())
+}
+
+/*
+	authorized checks the signature and access token of a request to the API
+	before calling h.
+*/
+func (s *Server) authorized(h http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params, err := oauthParams(r)
+		if err != nil {
+			badParameter(w, err.Error())
+			return
+		}
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			if err := r.ParseMultipartForm(32 << 20); err != nil {
+				badParameter(w, err.Error())
+				return
+			}
+		}
+
+		s.mu.Lock()
+		secret, ok := s.accTokens[params.Get("oauth_token")]
+		s.mu.Unlock()
+
+		if params.Get("oauth_consumer_key") != s.consumer.Token {
+			writeFail(w, http.StatusUnauthorized, "401", "invalid consumer key")
+			return
+		}
+		if !ok {
+			writeFail(w, http.StatusInternalServerError, string(ynote.CodeTokenExpired), "invalid access token")
+			return
+		}
+		if !checkSignature(r, params, s.consumer.Secret, secret) {
+			writeFail(w, http.StatusUnauthorized, "401", "invalid signature")
+			return
+		}
+		h(w, r)
+	})
+}
+
+func (s *Server) handleUser(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var used int64
+	var lastModify time.Time
+	for _, n := range s.notes {
+		used += int64(len(n.content))
+		if n.modifyTime.After(lastModify) {
+			lastModify = n.modifyTime
+		}
+	}
+	for _, res := range s.resources {
+		used += int64(len(res))
+	}
+
+	defaultNotebook := ""
+	for _, p := range s.sortedNotebooks() {
+		defaultNotebook = p
+		break
+	}
+
+	ms := func(t time.Time) int64 {
+		return t.UnixNano() / int64(time.Millisecond)
+	}
+	writeJSON(w, map[string]interface{}{
+		"id":               User,
+		"user":             User,
+		"register_time":    ms(s.registered),
+		"last_login_time":  ms(s.Now()),
+		"last_modify_time": ms(lastModify),
+		"total_size":       int64(1 << 30),
+		"used_size":        used,
+		"default_notebook": defaultNotebook,
+	})
+}
+
+func (s *Server) sortedNotebooks() []string {
+	paths := make([]string, 0, len(s.notebooks))
+	for p := range s.notebooks {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (s *Server) notebookJSON(p string) map[string]interface{} {
+	nb := s.notebooks[p]
+	return map[string]interface{}{
+		"path":        p,
+		"name":        nb.name,
+		"group":       nb.group,
+		"notes_num":   len(nb.notes),
+		"create_time": nb.createTime.Unix(),
+		"modify_time": nb.modifyTime.Unix(),
+	}
+}
+
+func (s *Server) handleCreateNotebook(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue("name")
+	if name == "" {
+		badParameter(w, "name is required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, nb := range s.notebooks {
+		if nb.name == name {
+			badParameter(w, "notebook "+name+" already exists")
+			return
+		}
+	}
+	p := "/" + newID()
+	now := s.Now()
+	s.notebooks[p] = &notebook{
+		name:       name,
+		group:      r.FormValue("group"),
+		createTime: now,
+		modifyTime: now,
+	}
+	writeJSON(w, s.notebookJSON(p))
+}
+
+func (s *Server) handleAllNotebooks(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nbs := []map[string]interface{}{}
+	for _, p := range s.sortedNotebooks() {
+		nbs = append(nbs, s.notebookJSON(p))
+	}
+	writeJSON(w, nbs)
+}
+
+func (s *Server) handleListNotes(w http.ResponseWriter, r *http.Request) {
+	p := r.FormValue("notebook")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nb := s.notebooks[p]
+	if nb == nil {
+		notFound(w, "notebook", p)
+		return
+	}
+	writeJSON(w, append([]string{}, nb.notes...))
+}
+
+func (s *Server) handleDeleteNotebook(w http.ResponseWriter, r *http.Request) {
+	p := r.FormValue("notebook")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nb := s.notebooks[p]
+	if nb == nil {
+		notFound(w, "notebook", p)
+		return
+	}
+	for _, n := range nb.notes {
+		delete(s.notes, n)
+	}
+	delete(s.notebooks, p)
+	writeJSON(w, map[string]interface{}{})
+}
+
+func (n *note) info() *ynote.NoteInfo {
+	return &ynote.NoteInfo{
+		Title:      n.title,
+		Author:     n.author,
+		Source:     n.source,
+		Size:       int64(len(n.content)),
+		CreateTime: time.Unix(n.createTime.Unix(), 0),
+		ModifyTime: time.Unix(n.modifyTime.Unix(), 0),
+		Content:    n.content,
+	}
+}
+
+func removeString(list []string, s string) []string {
+	for i, e := range list {
+		if e == s {
+			return append(list[:i:i], list[i+1:]...)
+		}
+	}
+	return list
+}
+
+func (s *Server) handleCreateNote(w http.ResponseWriter, r *http.Request) {
+	nbPath := r.FormValue("notebook")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nb := s.notebooks[nbPath]
+	if nb == nil {
+		notFound(w, "notebook", nbPath)
+		return
+	}
+
+	p := nbPath + "/" + newID()
+	now := s.Now()
+	s.notes[p] = &note{
+		notebook:   nbPath,
+		title:      r.FormValue("title"),
+		author:     r.FormValue("author"),
+		source:     r.FormValue("source"),
+		content:    r.FormValue("content"),
+		createTime: now,
+		modifyTime: now,
+	}
+	nb.notes = append(nb.notes, p)
+	nb.modifyTime = now
+	writeJSON(w, map[string]string{"path": p})
+}
+
+func (s *Server) handleGetNote(w http.ResponseWriter, r *http.Request) {
+	p := r.FormValue("path")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := s.notes[p]
+	if n == nil {
+		notFound(w, "note", p)
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"title":       n.title,
+		"author":      n.author,
+		"source":      n.source,
+		"size":        len(n.content),
+		"create_time": n.createTime.Unix(),
+		"modify_time": n.modifyTime.Unix(),
+		"content":     n.content,
+	})
+}
+
+func (s *Server) handleUpdateNote(w http.ResponseWriter, r *http.Request) {
+	p := r.FormValue("path")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := s.notes[p]
+	if n == nil {
+		notFound(w, "note", p)
+		return
+	}
+	n.title = r.FormValue("title")
+	n.author = r.FormValue("author")
+	n.source = r.FormValue("source")
+	n.content = r.FormValue("content")
+	n.modifyTime = s.Now()
+	s.notebooks[n.notebook].modifyTime = n.modifyTime
+	writeJSON(w, map[string]interface{}{})
+}
+
+func (s *Server) handleDeleteNote(w http.ResponseWriter, r *http.Request) {
+	p := r.FormValue("path")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := s.notes[p]
+	if n == nil {
+		notFound(w, "note", p)
+		return
+	}
+	nb := s.notebooks[n.notebook]
+	nb.notes = removeString(nb.notes, p)
+	nb.modifyTime = s.Now()
+	delete(s.notes, p)
+	writeJSON(w, map[string]interface{}{})
+}
+
+func (s *Server) handleMoveNote(w http.ResponseWriter, r *http.Request) {
+	p, nbPath := r.FormValue("path"), r.FormValue("notebook")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := s.notes[p]
+	if n == nil {
+		notFound(w, "note", p)
+		return
+	}
+	to := s.notebooks[nbPath]
+	if to == nil {
+		notFound(w, "notebook", nbPath)
+		return
+	}
+	// The path of a note does not change when moved.
+	now := s.Now()
+	from := s.notebooks[n.notebook]
+	from.notes = removeString(from.notes, p)
+	from.modifyTime = now
+	to.notes = append(to.notes, p)
+	to.modifyTime = now
+	n.notebook = nbPath
+	writeJSON(w, map[string]string{"path": p})
+}
+
+/*
+	handleUpload saves an uploaded resource. As the service, src is empty for
+	images, and the URL of an icon for other files.
+*/
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	f, hdr, err := r.FormFile("file")
+	if err != nil {
+		badParameter(w, "file is required")
+		return
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		badParameter(w, err.Error())
+		return
+	}
+
+	id := newID() + path.Ext(hdr.Filename)
+	s.mu.Lock()
+	s.resources[id] = data
+	s.mu.Unlock()
+
+	src := ""
+	if !strings.HasPrefix(http.DetectContentType(data), "image/") {
+		src = s.URL + "/yws/open/resource/icon/" + strings.TrimPrefix(path.Ext(hdr.Filename), ".")
+	}
+	writeJSON(w, map[string]string{
+		"url": s.URL + "/yws/open/resource/download/" + id,
+		"src": src,
+	})
+}
+
+/* handleDownload serves a resource, with support of Range requests. */
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	id := path.Base(r.URL.Path)
+
+	s.mu.Lock()
+	data, ok := s.resources[id]
+	s.mu.Unlock()
+
+	if !ok {
+		notFound(w, "resource", id)
+		return
+	}
+	http.ServeContent(w, r, id, s.registered, bytes.NewReader(data))
+}